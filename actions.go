@@ -0,0 +1,234 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"time"
+)
+
+//A sequence of actions performed by a single input source (see PerformActions).
+//Type is one of "none", "key", "pointer" or "wheel".
+type ActionSequence struct {
+	Type       string                   `json:"type"`
+	Id         string                   `json:"id"`
+	Parameters map[string]interface{}   `json:"parameters,omitempty"`
+	Actions    []map[string]interface{} `json:"actions"`
+}
+
+//Perform a sequence of actions with the W3C Actions API.
+//The sequences are executed in parallel, one tick at a time.
+func (s Session) PerformActions(actions []ActionSequence) error {
+	p := params{"actions": actions}
+	_, _, err := s.wd.do(p, "POST", "/session/%s/actions", s.Id)
+	return err
+}
+
+//Release all the keys and pointer buttons that are currently depressed.
+func (s Session) ReleaseActions() error {
+	_, _, err := s.wd.do(nil, "DELETE", "/session/%s/actions", s.Id)
+	return err
+}
+
+func mouseActions(actions ...map[string]interface{}) ActionSequence {
+	return ActionSequence{
+		Type:       "pointer",
+		Id:         "mouse",
+		Parameters: map[string]interface{}{"pointerType": "mouse"},
+		Actions:    actions,
+	}
+}
+
+//move the pointer by x, y from origin that can be "viewport", "pointer" or a WebElement (in which case the offset is relative to the center of the element).
+func pointerMove(origin interface{}, x, y int, duration time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "pointerMove",
+		"origin":   origin,
+		"x":        x,
+		"y":        y,
+		"duration": int(duration / time.Millisecond),
+	}
+}
+
+func touchActions(actions ...map[string]interface{}) ActionSequence {
+	return ActionSequence{
+		Type:       "pointer",
+		Id:         "finger",
+		Parameters: map[string]interface{}{"pointerType": "touch"},
+		Actions:    actions,
+	}
+}
+
+func pause(duration time.Duration) map[string]interface{} {
+	return map[string]interface{}{"type": "pause", "duration": int(duration / time.Millisecond)}
+}
+
+func pointerDown(button MouseButton) map[string]interface{} {
+	return map[string]interface{}{"type": "pointerDown", "button": button}
+}
+
+func pointerUp(button MouseButton) map[string]interface{} {
+	return map[string]interface{}{"type": "pointerUp", "button": button}
+}
+
+func keyActions(actions ...map[string]interface{}) ActionSequence {
+	return ActionSequence{
+		Type:    "key",
+		Id:      "keyboard",
+		Actions: actions,
+	}
+}
+
+func keyDown(key string) map[string]interface{} {
+	return map[string]interface{}{"type": "keyDown", "value": key}
+}
+
+func keyUp(key string) map[string]interface{} {
+	return map[string]interface{}{"type": "keyUp", "value": key}
+}
+
+//Clear a TEXTAREA or text INPUT element by selecting all its content with Ctrl+A and deleting it, as a user would.
+//Unlike Clear, the browser dispatches the keyboard and input events, so use ForceClear on widgets that
+//ignore or undo the protocol clear (e.g. controlled React inputs) and Clear everywhere else, as it is faster.
+//Select all is not bound to Ctrl+A on macOS.
+func (e WebElement) ForceClear() error {
+	if err := e.Click(); err != nil {
+		return err
+	}
+	if !e.s.W3C {
+		return e.SendKeys(Chord(KeyControl, "a") + KeyDelete)
+	}
+	return e.s.PerformActions([]ActionSequence{keyActions(
+		keyDown(KeyControl), keyDown("a"), keyUp("a"), keyUp(KeyControl),
+		keyDown(KeyBackspace), keyUp(KeyBackspace),
+	)})
+}
+
+func wheelActions(actions ...map[string]interface{}) ActionSequence {
+	return ActionSequence{
+		Type:    "wheel",
+		Id:      "wheel",
+		Actions: actions,
+	}
+}
+
+//scroll by deltaX, deltaY with the pointer at x, y from origin, that can be "viewport" or a WebElement.
+func scroll(origin interface{}, x, y, deltaX, deltaY int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "scroll",
+		"origin":   origin,
+		"x":        x,
+		"y":        y,
+		"deltaX":   deltaX,
+		"deltaY":   deltaY,
+		"duration": 0,
+	}
+}
+
+//Scroll the page by dx, dy pixels with the mouse wheel, so that the page receives wheel events (e.g. to load the content of an infinite scroll).
+//Legacy drivers scroll the window with a script, without wheel events.
+func (s Session) ScrollBy(dx, dy int) error {
+	if !s.W3C {
+		_, err := s.ExecuteScript("window.scrollBy(arguments[0], arguments[1]); return null;", []interface{}{dx, dy})
+		return err
+	}
+	return s.PerformActions([]ActionSequence{wheelActions(scroll("viewport", 0, 0, dx, dy))})
+}
+
+//Scroll the element into view with the mouse wheel.
+//Legacy drivers use ScrollIntoView instead, without wheel events.
+func (s Session) ScrollToElement(element WebElement) error {
+	if !s.W3C {
+		return element.ScrollIntoView(false)
+	}
+	//the driver scrolls an element origin into view before scrolling by the deltas
+	return s.PerformActions([]ActionSequence{wheelActions(scroll(element, 0, 0, 0, 0))})
+}
+
+//Move the pointer over the center of the element without clicking, e.g. to open a menu shown on :hover.
+func (e WebElement) Hover() error {
+	return e.s.MoveToElement(e)
+}
+
+//Double-click in the center of the element.
+func (e WebElement) DoubleClick() error {
+	if e.s.W3C {
+		return e.s.PerformActions([]ActionSequence{mouseActions(
+			pointerMove(e, 0, 0, 0),
+			pointerDown(LeftButton), pointerUp(LeftButton),
+			pointerDown(LeftButton), pointerUp(LeftButton),
+		)})
+	}
+	if err := e.s.MoveToElement(e); err != nil {
+		return err
+	}
+	return e.s.DoubleClick()
+}
+
+//Click with the right mouse button in the center of the element (e.g. to open a context menu).
+func (e WebElement) ContextClick() error {
+	if e.s.W3C {
+		return e.s.PerformActions([]ActionSequence{mouseActions(
+			pointerMove(e, 0, 0, 0),
+			pointerDown(RightButton), pointerUp(RightButton),
+		)})
+	}
+	if err := e.s.MoveToElement(e); err != nil {
+		return err
+	}
+	return e.s.Click(RightButton)
+}
+
+//Press the left button in the center of the element, move the pointer by dx, dy pixels and release it, e.g. to move the thumb of a slider or to draw on a canvas.
+func (e WebElement) DragBy(dx, dy int) error {
+	if e.s.W3C {
+		return e.s.PerformActions([]ActionSequence{mouseActions(
+			pointerMove(e, 0, 0, 0),
+			pointerDown(LeftButton),
+			pointerMove("pointer", dx, dy, 0),
+			pointerUp(LeftButton),
+		)})
+	}
+	if err := e.s.MoveToElement(e); err != nil {
+		return err
+	}
+	if err := e.s.ButtonDown(LeftButton); err != nil {
+		return err
+	}
+	//without an element the move is relative to the current position
+	p := params{"xoffset": dx, "yoffset": dy}
+	if _, _, err := e.s.wd.do(p, "POST", "/session/%s/moveto", e.s.Id); err != nil {
+		return err
+	}
+	return e.s.ButtonUp(LeftButton)
+}
+
+//Tap in the center of the element with a touch pointer (W3C Actions API).
+func (s Session) TapElement(element WebElement) error {
+	return s.PerformActions([]ActionSequence{touchActions(
+		pointerMove(element, 0, 0, 0),
+		pointerDown(LeftButton), pointerUp(LeftButton),
+	)})
+}
+
+//Touch the screen at fromX, fromY and move the finger to toX, toY in duration (W3C Actions API).
+//Coordinates are relative to the viewport.
+func (s Session) Swipe(fromX, fromY, toX, toY int, duration time.Duration) error {
+	return s.PerformActions([]ActionSequence{touchActions(
+		pointerMove("viewport", fromX, fromY, 0),
+		pointerDown(LeftButton),
+		pointerMove("viewport", toX, toY, duration),
+		pointerUp(LeftButton),
+	)})
+}
+
+//Touch the center of the element and keep the finger down for duration (W3C Actions API).
+func (s Session) LongPress(element WebElement, duration time.Duration) error {
+	return s.PerformActions([]ActionSequence{touchActions(
+		pointerMove(element, 0, 0, 0),
+		pointerDown(LeftButton),
+		pause(duration),
+		pointerUp(LeftButton),
+	)})
+}
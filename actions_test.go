@@ -0,0 +1,354 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoubleClickW3C(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.W3C = true
+	err := s.WebElementFromId("0").DoubleClick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*requests))
+	}
+	r := (*requests)[0]
+	if r.Method != "POST" || r.Path != "/session/mock/actions" {
+		t.Fatalf("unexpected request: %s %s", r.Method, r.Path)
+	}
+	var body struct {
+		Actions []ActionSequence
+	}
+	if err = json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Actions) != 1 || body.Actions[0].Type != "pointer" {
+		t.Fatalf("unexpected actions: %s", r.Body)
+	}
+	var types []string
+	for _, a := range body.Actions[0].Actions {
+		types = append(types, a["type"].(string))
+	}
+	expected := []string{"pointerMove", "pointerDown", "pointerUp", "pointerDown", "pointerUp"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("unexpected action types: %v", types)
+	}
+	origin := body.Actions[0].Actions[0]["origin"].(map[string]interface{})
+	if origin[webElementIdentifier] != "0" {
+		t.Fatalf("unexpected origin: %v", origin)
+	}
+}
+
+func TestContextClickLegacy(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	err := s.WebElementFromId("0").ContextClick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(*requests))
+	}
+	if r := (*requests)[0]; r.Path != "/session/mock/moveto" || r.Body != `{"element":"0"}` {
+		t.Fatalf("unexpected moveto: %s %s", r.Path, r.Body)
+	}
+	if r := (*requests)[1]; r.Path != "/session/mock/click" || r.Body != `{"button":2}` {
+		t.Fatalf("unexpected click: %s %s", r.Path, r.Body)
+	}
+}
+
+func TestMoveToElement(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	if err := s.MoveToElement(s.WebElementFromId("0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MoveTo(s.WebElementFromId("0"), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[0]; r.Path != "/session/mock/moveto" || r.Body != `{"element":"0"}` {
+		t.Fatalf("unexpected center moveto: %s %s", r.Path, r.Body)
+	}
+	if r := (*requests)[1]; r.Body != `{"element":"0","xoffset":0,"yoffset":0}` {
+		t.Fatalf("unexpected offset moveto: %s", r.Body)
+	}
+}
+
+func TestMoveToElementW3C(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.W3C = true
+	if err := s.MoveToElement(s.WebElementFromId("0")); err != nil {
+		t.Fatal(err)
+	}
+	r := (*requests)[0]
+	if r.Path != "/session/mock/actions" {
+		t.Fatalf("unexpected request: %s %s", r.Method, r.Path)
+	}
+	var body struct {
+		Actions []ActionSequence
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	move := body.Actions[0].Actions[0]
+	if move["type"] != "pointerMove" || move["x"] != 0.0 || move["y"] != 0.0 {
+		t.Fatalf("unexpected move: %v", move)
+	}
+}
+
+func TestTouchActions(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.W3C = true
+	e := s.WebElementFromId("0")
+	if err := s.TapElement(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Swipe(10, 400, 10, 100, 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LongPress(e, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	element := `{"ELEMENT":"0","element-6066-11e4-a52e-4f735466cecf":"0"}`
+	sequence := `{"actions":[{"type":"pointer","id":"finger","parameters":{"pointerType":"touch"},"actions":[%s]}]}`
+	expected := []string{
+		fmt.Sprintf(sequence, `{"duration":0,"origin":`+element+`,"type":"pointerMove","x":0,"y":0},`+
+			`{"button":0,"type":"pointerDown"},{"button":0,"type":"pointerUp"}`),
+		fmt.Sprintf(sequence, `{"duration":0,"origin":"viewport","type":"pointerMove","x":10,"y":400},`+
+			`{"button":0,"type":"pointerDown"},`+
+			`{"duration":300,"origin":"viewport","type":"pointerMove","x":10,"y":100},`+
+			`{"button":0,"type":"pointerUp"}`),
+		fmt.Sprintf(sequence, `{"duration":0,"origin":`+element+`,"type":"pointerMove","x":0,"y":0},`+
+			`{"button":0,"type":"pointerDown"},{"duration":1000,"type":"pause"},{"button":0,"type":"pointerUp"}`),
+	}
+	for i, r := range *requests {
+		if r.Path != "/session/mock/actions" || r.Body != expected[i] {
+			t.Fatalf("unexpected request %d: %s\n%s", i, r.Path, r.Body)
+		}
+	}
+}
+
+func TestElementMouseEvents(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("mouse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElement(ID, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = we.DoubleClick(); err != nil {
+		t.Fatal(err)
+	}
+	if event, err := we.GetAttribute("data-event"); err != nil || event != "dblclick" {
+		t.Fatalf("dblclick handler not fired: %q %v", event, err)
+	}
+	if err = we.ContextClick(); err != nil {
+		t.Fatal(err)
+	}
+	if event, err := we.GetAttribute("data-event"); err != nil || event != "contextmenu" {
+		t.Fatalf("contextmenu handler not fired: %q %v", event, err)
+	}
+}
+
+func TestHover(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("hover"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := session.FindElement(ID, "item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if displayed, err := item.IsDisplayed(); err != nil || displayed {
+		t.Fatalf("item should be hidden before hover (%v)", err)
+	}
+	menu, err := session.FindElement(ID, "menu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = menu.Hover(); err != nil {
+		t.Fatal(err)
+	}
+	if displayed, err := item.IsDisplayed(); err != nil || !displayed {
+		t.Fatalf("item should be displayed after hover (%v)", err)
+	}
+}
+
+func TestForceClearMock(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.W3C = true
+	if err := s.WebElementFromId("0").ForceClear(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"actions":[{"type":"key","id":"keyboard","actions":[` +
+		`{"type":"keyDown","value":"` + KeyControl + `"},{"type":"keyDown","value":"a"},` +
+		`{"type":"keyUp","value":"a"},{"type":"keyUp","value":"` + KeyControl + `"},` +
+		`{"type":"keyDown","value":"` + KeyBackspace + `"},{"type":"keyUp","value":"` + KeyBackspace + `"}]}]}`
+	r := *requests
+	if len(r) != 2 || r[0].Path != "/session/mock/element/0/click" {
+		t.Fatalf("unexpected requests: %v", r)
+	}
+	if r[1].Path != "/session/mock/actions" || r[1].Body != expected {
+		t.Fatalf("unexpected request: %s\n%s", r[1].Path, r[1].Body)
+	}
+}
+
+func TestForceClear(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("stubborn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := session.FindElement(ID, "stubborn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = input.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := input.Value(); err != nil || value != "default" {
+		t.Fatalf("protocol clear should be rejected, got %q (%v)", value, err)
+	}
+	if err = input.ForceClear(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := input.Value(); err != nil || value != "" {
+		t.Fatalf("element not cleared, got %q (%v)", value, err)
+	}
+}
+
+func TestDragByMock(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	e := s.WebElementFromId("0")
+	if err := e.DragBy(30, -10); err != nil {
+		t.Fatal(err)
+	}
+	var legacy []string
+	for _, r := range *requests {
+		legacy = append(legacy, r.Path+" "+r.Body)
+	}
+	expected := []string{
+		`/session/mock/moveto {"element":"0"}`,
+		`/session/mock/buttondown {"button":0}`,
+		`/session/mock/moveto {"xoffset":30,"yoffset":-10}`,
+		`/session/mock/buttonup {"button":0}`,
+	}
+	if !reflect.DeepEqual(legacy, expected) {
+		t.Fatalf("unexpected legacy requests: %v", legacy)
+	}
+	*requests = nil
+	s.W3C = true
+	if err := s.WebElementFromId("0").DragBy(30, -10); err != nil {
+		t.Fatal(err)
+	}
+	element := `{"ELEMENT":"0","element-6066-11e4-a52e-4f735466cecf":"0"}`
+	w3c := `{"actions":[{"type":"pointer","id":"mouse","parameters":{"pointerType":"mouse"},"actions":[` +
+		`{"duration":0,"origin":` + element + `,"type":"pointerMove","x":0,"y":0},` +
+		`{"button":0,"type":"pointerDown"},` +
+		`{"duration":0,"origin":"pointer","type":"pointerMove","x":30,"y":-10},` +
+		`{"button":0,"type":"pointerUp"}]}]}`
+	if r := (*requests)[0]; r.Path != "/session/mock/actions" || r.Body != w3c {
+		t.Fatalf("unexpected request: %s\n%s", r.Path, r.Body)
+	}
+}
+
+func TestDragBy(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("range"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slider, err := session.FindElement(ID, "slider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = slider.DragBy(80, 0); err != nil {
+		t.Fatal(err)
+	}
+	value, err := slider.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := strconv.Atoi(value); err != nil || v <= 50 {
+		t.Fatalf("slider value should be increased, got %q", value)
+	}
+}
+
+func TestScrollMock(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.W3C = true
+	if err := s.ScrollBy(0, 500); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ScrollToElement(s.WebElementFromId("0")); err != nil {
+		t.Fatal(err)
+	}
+	element := `{"ELEMENT":"0","element-6066-11e4-a52e-4f735466cecf":"0"}`
+	sequence := `{"actions":[{"type":"wheel","id":"wheel","actions":[%s]}]}`
+	expected := []string{
+		fmt.Sprintf(sequence, `{"deltaX":0,"deltaY":500,"duration":0,"origin":"viewport","type":"scroll","x":0,"y":0}`),
+		fmt.Sprintf(sequence, `{"deltaX":0,"deltaY":0,"duration":0,"origin":`+element+`,"type":"scroll","x":0,"y":0}`),
+	}
+	for i, r := range *requests {
+		if r.Path != "/session/mock/actions" || r.Body != expected[i] {
+			t.Fatalf("unexpected request %d: %s\n%s", i, r.Path, r.Body)
+		}
+	}
+	*requests = nil
+	s.W3C = false
+	if err := s.ScrollBy(0, 500); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[0]; r.Path != "/session/mock/execute" || !strings.Contains(r.Body, "scrollBy") {
+		t.Fatalf("unexpected legacy request: %s %s", r.Path, r.Body)
+	}
+}
+
+func TestScroll(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//wheel scrolling may be smooth, wait for the page to reach the position
+	offset := func(expected func(y int) bool) error {
+		return waitForValue("scroll", "true", 2*time.Second, func() (string, error) {
+			data, err := session.ExecuteScript("return window.pageYOffset;", []interface{}{})
+			if err != nil {
+				return "", err
+			}
+			var y float64
+			err = json.Unmarshal(data, &y)
+			return strconv.FormatBool(expected(int(y))), err
+		})
+	}
+	if err = session.ScrollBy(0, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err = offset(func(y int) bool { return y >= 1000 }); err != nil {
+		t.Fatal(err)
+	}
+	bottom, err := session.FindElement(ID, "bottom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.ScrollToElement(bottom); err != nil {
+		t.Fatal(err)
+	}
+	if err = offset(func(y int) bool { return y > 4000 }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+//Create an empty set of capabilities that can be filled using Set and Browser.
+//	desired := webdriver.NewCapabilities().Browser("chrome").Set("Platform", "Linux")
+func NewCapabilities() Capabilities {
+	return Capabilities{}
+}
+
+//Set the capability key to value and return the capabilities to allow chaining.
+func (c Capabilities) Set(key string, value interface{}) Capabilities {
+	c[key] = value
+	return c
+}
+
+//Set the "browserName" capability.
+func (c Capabilities) Browser(name string) Capabilities {
+	return c.Set("browserName", name)
+}
+
+//Set the "webSocketUrl" capability, asking a driver that supports WebDriver BiDi to return the URL of its WebSocket (see Session.WebSocketURL).
+func (c Capabilities) WithWebSocketURL(enabled bool) Capabilities {
+	return c.Set("webSocketUrl", enabled)
+}
+
+//Return the WebSocket URL returned by the driver in the "webSocketUrl" capability, that can be used to open a WebDriver BiDi connection.
+//It is present only if requested with WithWebSocketURL and supported by the driver.
+func (s Session) WebSocketURL() (string, bool) {
+	url, ok := s.Capabilities["webSocketUrl"].(string)
+	return url, ok && url != ""
+}
+
+//Return a new set of capabilities with the content of other merged into c.
+//Values in other override values in c, with the exception of nested maps (e.g.
+//"goog:chromeOptions") that are merged recursively and slices (e.g. chrome
+//"args") that are concatenated. Neither c nor other are modified.
+func (c Capabilities) Merge(other Capabilities) Capabilities {
+	return Capabilities(mergeMaps(c, other))
+}
+
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		m[k] = copyValue(v)
+	}
+	for k, v := range b {
+		m[k] = mergeValues(m[k], v)
+	}
+	return m
+}
+
+func mergeValues(a, b interface{}) interface{} {
+	if am, ok := asMap(a); ok {
+		if bm, ok := asMap(b); ok {
+			return mergeMaps(am, bm)
+		}
+	}
+	if x, ok := a.([]string); ok {
+		if y, ok := b.([]string); ok {
+			return append(append([]string{}, x...), y...)
+		}
+	}
+	if x, ok := asSlice(a); ok {
+		if y, ok := asSlice(b); ok {
+			return append(x, y...)
+		}
+	}
+	return copyValue(b)
+}
+
+//copy maps and slices so that the merged capabilities don't share them with
+//the originals.
+func copyValue(v interface{}) interface{} {
+	if m, ok := asMap(v); ok {
+		return mergeMaps(m, nil)
+	}
+	switch x := v.(type) {
+	case []interface{}:
+		return append([]interface{}{}, x...)
+	case []string:
+		return append([]string{}, x...)
+	}
+	return v
+}
+
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return x, true
+	case Capabilities:
+		return x, true
+	case params:
+		return x, true
+	}
+	return nil, false
+}
+
+//return a copy of v as a []interface{} if it is a slice.
+func asSlice(v interface{}) ([]interface{}, bool) {
+	switch x := v.(type) {
+	case []interface{}:
+		return append([]interface{}{}, x...), true
+	case []string:
+		s := make([]interface{}, len(x))
+		for i, e := range x {
+			s[i] = e
+		}
+		return s, true
+	}
+	return nil, false
+}
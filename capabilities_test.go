@@ -0,0 +1,86 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCapabilitiesBuilder(t *testing.T) {
+	c := NewCapabilities().Browser("chrome").Set("Platform", "Linux")
+	expected := Capabilities{"browserName": "chrome", "Platform": "Linux"}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("unexpected capabilities: %v", c)
+	}
+}
+
+func TestCapabilitiesMergeShallow(t *testing.T) {
+	base := Capabilities{"browserName": "chrome", "Platform": "Linux"}
+	override := Capabilities{"Platform": "Windows", "acceptSslCerts": true}
+	merged := base.Merge(override)
+	expected := Capabilities{"browserName": "chrome", "Platform": "Windows", "acceptSslCerts": true}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("unexpected merged capabilities: %v", merged)
+	}
+	if base["Platform"] != "Linux" {
+		t.Fatal("Merge modified the receiver")
+	}
+}
+
+func TestCapabilitiesMergeNested(t *testing.T) {
+	base := Capabilities{
+		"goog:chromeOptions": map[string]interface{}{
+			"args":   []interface{}{"--headless"},
+			"binary": "/usr/bin/chromium",
+			"prefs":  map[string]interface{}{"a": 1},
+		},
+	}
+	override := Capabilities{
+		"goog:chromeOptions": map[string]interface{}{
+			"args":  []interface{}{"--no-sandbox"},
+			"prefs": map[string]interface{}{"b": 2},
+		},
+	}
+	merged := base.Merge(override)
+	expected := Capabilities{
+		"goog:chromeOptions": map[string]interface{}{
+			"args":   []interface{}{"--headless", "--no-sandbox"},
+			"binary": "/usr/bin/chromium",
+			"prefs":  map[string]interface{}{"a": 1, "b": 2},
+		},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("unexpected merged capabilities: %v", merged)
+	}
+	args := base["goog:chromeOptions"].(map[string]interface{})["args"].([]interface{})
+	if len(args) != 1 {
+		t.Fatal("Merge modified nested values of the receiver")
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	c := NewCapabilities().Browser("firefox").WithWebSocketURL(true)
+	if c["webSocketUrl"] != true {
+		t.Fatalf("unexpected capabilities: %v", c)
+	}
+	var returned Capabilities
+	data := `{"browserName":"firefox","webSocketUrl":"ws://127.0.0.1:9222/session/abc"}`
+	if err := json.Unmarshal([]byte(data), &returned); err != nil {
+		t.Fatal(err)
+	}
+	s := Session{Capabilities: returned}
+	if url, ok := s.WebSocketURL(); !ok || url != "ws://127.0.0.1:9222/session/abc" {
+		t.Fatalf("unexpected WebSocket URL: %q, %v", url, ok)
+	}
+	//drivers that don't support BiDi ignore the capability or return it unchanged
+	for _, value := range []interface{}{nil, true} {
+		s = Session{Capabilities: Capabilities{"webSocketUrl": value}}
+		if url, ok := s.WebSocketURL(); ok {
+			t.Fatalf("unexpected WebSocket URL: %q", url)
+		}
+	}
+}
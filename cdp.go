@@ -0,0 +1,37 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"strings"
+)
+
+//Execute a Chrome DevTools Protocol command (e.g. "Network.clearBrowserCache") and return its JSON result.
+//It is supported only by chromedriver.
+func (s Session) ExecuteCDP(cmd string, args map[string]interface{}) ([]byte, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	p := params{"cmd": cmd, "params": args}
+	_, data, err := s.wd.do(p, "POST", "/session/%s/goog/cdp/execute", s.Id)
+	return data, err
+}
+
+//check if the session is driven by chromedriver, that supports the DevTools protocol (see ExecuteCDP).
+//Besides chrome, it is the case of chromium and of chrome-headless-shell.
+func (s Session) isChromium() bool {
+	switch s.browserName() {
+	case "chrome", "chromium", "chrome-headless-shell":
+		return true
+	}
+	_, found := s.Capabilities["goog:chromeOptions"]
+	return found
+}
+
+//return the lowercase browserName capability of the session, e.g. "chrome" or "firefox".
+func (s Session) browserName() string {
+	name, _ := s.Capabilities["browserName"].(string)
+	return strings.ToLower(name)
+}
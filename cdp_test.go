@@ -0,0 +1,99 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExecuteCDP(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		return map[string]string{"product": "Chrome"}
+	})
+	data, err := s.ExecuteCDP("Browser.getVersion", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"product":"Chrome"}` {
+		t.Fatalf("unexpected result: %s", data)
+	}
+	r := (*requests)[0]
+	if r.Path != "/session/mock/goog/cdp/execute" || r.Body != `{"cmd":"Browser.getVersion","params":{}}` {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+}
+
+func TestSetDevicePixelRatio(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.Capabilities = Capabilities{"browserName": "chrome"}
+	if err := s.SetDevicePixelRatio(2); err != nil {
+		t.Fatal(err)
+	}
+	r := (*requests)[0]
+	expected := `{"cmd":"Emulation.setDeviceMetricsOverride","params":{"deviceScaleFactor":2,"height":0,"mobile":false,"width":0}}`
+	if r.Path != "/session/mock/goog/cdp/execute" || r.Body != expected {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	for _, ratio := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if err := s.SetDevicePixelRatio(ratio); err == nil {
+			t.Fatalf("ratio %v should be rejected", ratio)
+		}
+	}
+	s.Capabilities = Capabilities{"browserName": "firefox"}
+	if err := s.SetDevicePixelRatio(2); err == nil {
+		t.Fatal("firefox should not be supported")
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("unexpected requests: %v", *requests)
+	}
+}
+
+func TestSetUserAgentRuntime(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	s.Capabilities = Capabilities{"browserName": "chrome"}
+	if err := s.SetUserAgentRuntime("webdriver agent"); err != nil {
+		t.Fatal(err)
+	}
+	r := (*requests)[0]
+	expected := `{"cmd":"Network.setUserAgentOverride","params":{"userAgent":"webdriver agent"}}`
+	if r.Path != "/session/mock/goog/cdp/execute" || r.Body != expected {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	s.Capabilities = Capabilities{"browserName": "firefox"}
+	if err := s.SetUserAgentRuntime("webdriver agent"); err == nil {
+		t.Fatal("firefox should not be supported")
+	}
+}
+
+func TestInitScript(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if strings.Contains(r.Body, "Page.addScriptToEvaluateOnNewDocument") {
+			return map[string]string{"identifier": "7"}
+		}
+		return map[string]string{}
+	})
+	s.Capabilities = Capabilities{"browserName": "chrome"}
+	id, err := s.AddInitScript("window.injected = true;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "7" {
+		t.Fatalf("unexpected identifier: %q", id)
+	}
+	if err = s.RemoveInitScript(id); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`{"cmd":"Page.addScriptToEvaluateOnNewDocument","params":{"source":"window.injected = true;"}}`,
+		`{"cmd":"Page.removeScriptToEvaluateOnNewDocument","params":{"identifier":"7"}}`,
+	}
+	for i, r := range *requests {
+		if r.Path != "/session/mock/goog/cdp/execute" || r.Body != expected[i] {
+			t.Fatalf("unexpected request %d: %+v", i, r)
+		}
+	}
+}
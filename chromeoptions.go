@@ -0,0 +1,129 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+//Chrome specific capabilities.
+//
+//See https://chromedriver.chromium.org/capabilities
+type ChromeOptions struct {
+	//Command line arguments to use when starting Chrome.
+	Args []string `json:"args,omitempty"`
+	//Path to the Chrome executable. Default: chromedriver looks for Chrome in the standard locations.
+	Binary string `json:"binary,omitempty"`
+	//Preferences of the user profile (e.g. "download.default_directory").
+	Prefs map[string]interface{} `json:"prefs,omitempty"`
+	//Events collected in the performance log. Requires LoggingPrefs["performance"] to be set.
+	PerfLoggingPrefs *PerfLoggingPrefs `json:"perfLoggingPrefs,omitempty"`
+	//Content of the packed extensions (.crx files) to install, they are sent base64 encoded (see AddExtensionFile).
+	Extensions [][]byte `json:"extensions,omitempty"`
+	//Default switches of chromedriver that are not passed to Chrome. ["enable-automation"] removes the
+	//"Chrome is being controlled by automated test software" infobar.
+	ExcludeSwitches []string `json:"excludeSwitches,omitempty"`
+	//Load the automation extension of chromedriver, set it to false together with ExcludeSwitches ["enable-automation"]. Default: nil (chromedriver default)
+	UseAutomationExtension *bool `json:"useAutomationExtension,omitempty"`
+	//Level of the logs collected for each log type (e.g. "browser", "performance"). It is sent as the "goog:loggingPrefs" capability.
+	LoggingPrefs map[string]LogLevel `json:"-"`
+}
+
+//Preferences of the Chrome performance log.
+type PerfLoggingPrefs struct {
+	//Collect network events.
+	EnableNetwork bool `json:"enableNetwork"`
+	//Collect page events.
+	EnablePage bool `json:"enablePage"`
+	//Comma-separated list of Chrome tracing categories to collect (e.g. "devtools.timeline").
+	TraceCategories string `json:"traceCategories,omitempty"`
+	//Requested interval in milliseconds between DevTools trace buffer usage events.
+	BufferUsageReportingInterval int `json:"bufferUsageReportingInterval,omitempty"`
+}
+
+//Collect all the entries of the browser and performance logs, including network and page events.
+//Once the session is created, the Chrome DevTools Protocol events are returned by Session.PerformanceLogs as JSON messages.
+func (o *ChromeOptions) EnablePerformanceLogging() {
+	if o.LoggingPrefs == nil {
+		o.LoggingPrefs = map[string]LogLevel{}
+	}
+	o.LoggingPrefs["browser"] = LogAll
+	o.LoggingPrefs["performance"] = LogAll
+	o.PerfLoggingPrefs = &PerfLoggingPrefs{EnableNetwork: true, EnablePage: true}
+}
+
+//Save downloaded files in path without asking.
+//mimeTypes is ignored and exists for symmetry with FirefoxDriver.SetDownloadDir: chrome saves all the files it doesn't display.
+func (o *ChromeOptions) SetDownloadDir(path string, mimeTypes []string) {
+	if o.Prefs == nil {
+		o.Prefs = map[string]interface{}{}
+	}
+	o.Prefs["download.default_directory"] = path
+	o.Prefs["download.prompt_for_download"] = false
+}
+
+//Start Chrome with the given User-Agent string, replacing a --user-agent argument already present.
+//Use Session.SetUserAgentRuntime to change it in a running session.
+func (o *ChromeOptions) SetUserAgent(ua string) {
+	o.setArg("--user-agent", ua)
+}
+
+//Start Chrome with the given UI language (e.g. "fr-FR") and send it in the Accept-Language header,
+//replacing a --lang argument already present.
+func (o *ChromeOptions) SetLanguage(lang string) {
+	o.setArg("--lang", lang)
+	if o.Prefs == nil {
+		o.Prefs = map[string]interface{}{}
+	}
+	o.Prefs["intl.accept_languages"] = lang
+}
+
+//add the argument name=value, replacing the value of the argument if already present.
+func (o *ChromeOptions) setArg(name, value string) {
+	arg := name + "=" + value
+	for i, a := range o.Args {
+		if strings.HasPrefix(a, name+"=") {
+			o.Args[i] = arg
+			return
+		}
+	}
+	o.Args = append(o.Args, arg)
+}
+
+//Install the packed extension (.crx file) in path.
+func (o *ChromeOptions) AddExtensionFile(path string) error {
+	crx, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New("add extension: " + err.Error())
+	}
+	if len(crx) == 0 {
+		return errors.New("add extension: empty file " + path)
+	}
+	o.Extensions = append(o.Extensions, crx)
+	return nil
+}
+
+//Return the capabilities matching the options. They can be merged with other capabilities:
+//	desired := webdriver.Capabilities{"Platform": "Linux"}.Merge(options.Capabilities())
+func (o *ChromeOptions) Capabilities() Capabilities {
+	c := Capabilities{"goog:chromeOptions": toJSONMap(o)}
+	if len(o.LoggingPrefs) > 0 {
+		c["goog:loggingPrefs"] = toJSONMap(o.LoggingPrefs)
+	}
+	return c
+}
+
+//convert v in a generic map using its JSON encoding, so that it can be merged with other capabilities.
+func toJSONMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	buf, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(buf, &m)
+	}
+	return m
+}
@@ -0,0 +1,131 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestChromeOptionsPerformanceLogging(t *testing.T) {
+	options := &ChromeOptions{}
+	options.EnablePerformanceLogging()
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"perfLoggingPrefs":{"enableNetwork":true,"enablePage":true}},` +
+		`"goog:loggingPrefs":{"browser":"ALL","performance":"ALL"}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities:\n%s\nexpected:\n%s", buf, expected)
+	}
+}
+
+func TestChromeOptionsMerge(t *testing.T) {
+	options := &ChromeOptions{Args: []string{"--headless"}}
+	base := Capabilities{"goog:chromeOptions": map[string]interface{}{"args": []string{"--no-sandbox"}}}
+	buf, err := json.Marshal(base.Merge(options.Capabilities()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"args":["--no-sandbox","--headless"]}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
+
+func TestChromeOptionsSetDownloadDir(t *testing.T) {
+	options := &ChromeOptions{}
+	options.SetDownloadDir("/tmp/downloads", []string{"application/pdf"})
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"prefs":{"download.default_directory":"/tmp/downloads","download.prompt_for_download":false}}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
+
+func TestChromeOptionsExcludeSwitches(t *testing.T) {
+	options := &ChromeOptions{}
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"goog:chromeOptions":{}}` {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+	useAutomationExtension := false
+	options.ExcludeSwitches = []string{"enable-automation"}
+	options.UseAutomationExtension = &useAutomationExtension
+	if buf, err = json.Marshal(options.Capabilities()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"excludeSwitches":["enable-automation"],"useAutomationExtension":false}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
+
+func TestChromeOptionsAddExtensionFile(t *testing.T) {
+	dir := t.TempDir()
+	crx := filepath.Join(dir, "extension.crx")
+	if err := ioutil.WriteFile(crx, []byte("Cr24 dummy extension"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.crx")
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := &ChromeOptions{}
+	if err := options.AddExtensionFile(crx); err != nil {
+		t.Fatal(err)
+	}
+	if err := options.AddExtensionFile(empty); err == nil {
+		t.Fatal("an empty file should be rejected")
+	}
+	if err := options.AddExtensionFile(filepath.Join(dir, "missing.crx")); err == nil {
+		t.Fatal("a missing file should be rejected")
+	}
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"extensions":["` + base64.StdEncoding.EncodeToString([]byte("Cr24 dummy extension")) + `"]}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
+
+func TestChromeOptionsSetLanguage(t *testing.T) {
+	options := &ChromeOptions{Args: []string{"--headless", "--lang=en-US"}}
+	options.SetLanguage("fr-FR")
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"args":["--headless","--lang=fr-FR"],"prefs":{"intl.accept_languages":"fr-FR"}}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
+
+func TestChromeOptionsSetUserAgent(t *testing.T) {
+	options := &ChromeOptions{Args: []string{"--headless", "--user-agent=old"}}
+	options.SetUserAgent("webdriver test")
+	options.SetUserAgent("webdriver agent")
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"goog:chromeOptions":{"args":["--headless","--user-agent=webdriver agent"]}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+//launch logic shared by the drivers of Chromium based browsers (e.g. chromedriver and msedgedriver)
+type chromiumDriver struct {
+	WebDriverCore
+	//The port that the driver listens on. Default: 9515
+	Port int
+	//The address used to reach the driver. If it is not a loopback address the driver accepts connections from any host. Default: 127.0.0.1
+	BindAddress string
+	//The URL path prefix to use for all incoming WebDriver REST requests. Default: ""
+	BaseUrl string
+	//The number of threads to use for handling HTTP requests. Default: 4
+	Threads int
+	//The path to use for the driver server log. Default: ./chromedriver.log (./msedgedriver.log for edge)
+	//The driver overwrites the log every time it starts unless AppendLog is set.
+	LogPath string
+	//Append to the log in LogPath instead of overwriting it. Default: false
+	AppendLog bool
+	//Truncate the log in LogPath before starting the driver, even if AppendLog is set. Default: false
+	TruncateLogOnStart bool
+	// Log file to dump the driver stdout/stderr. If "" send to terminal. Default: ""
+	LogFile string
+	// Start method fails if the driver doesn't start in less than StartTimeout. Default 20s.
+	StartTimeout time.Duration
+	// If true Start waits until the driver replies to the status command (see WaitForReady). Default false.
+	WaitReady bool
+
+	name string
+	path string
+	//the driver is managed by someone else: Start and Stop don't run it
+	remote  bool
+	cmd     *exec.Cmd
+	logFile *os.File
+	//closed when the driver process exits
+	exited <-chan struct{}
+}
+
+func newChromiumDriver(name, path string) chromiumDriver {
+	d := chromiumDriver{}
+	d.name = name
+	d.path = path
+	d.Port = 9515
+	d.BindAddress = "127.0.0.1"
+	d.BaseUrl = ""
+	d.Threads = 4
+	d.LogPath = name + ".log"
+	d.StartTimeout = 20 * time.Second
+	return d
+}
+
+func (d *chromiumDriver) Start() error {
+	return d.StartContext(context.Background())
+}
+
+//Like Start, but stop waiting for the driver to listen when ctx is done: the driver is killed and ctx.Err() is returned.
+func (d *chromiumDriver) StartContext(ctx context.Context) error {
+	if d.remote {
+		//BaseUrl may have been set after creating the driver
+		d.url = "http://" + d.address() + d.BaseUrl
+		return nil
+	}
+	csferr := d.name + " start failed: "
+	if d.cmd != nil {
+		return errors.New(csferr + d.name + " already running")
+	}
+
+	if d.LogPath != "" {
+		//check if log-path is writable
+		flags := os.O_WRONLY | os.O_CREATE
+		if d.TruncateLogOnStart {
+			flags |= os.O_TRUNC
+		}
+		file, err := os.OpenFile(d.LogPath, flags, 0664)
+		if err != nil {
+			return errors.New(csferr + "unable to write in log path: " + err.Error())
+		}
+		file.Close()
+	}
+
+	if !validHost(d.BindAddress) {
+		return errors.New(csferr + "invalid bind address: " + d.BindAddress)
+	}
+	d.url = "http://" + d.address() + d.BaseUrl
+	cmd := exec.Command(d.path, d.switches()...)
+	var err error
+	var stderr *tailBuffer
+	d.logFile, stderr, err = runBrowser(cmd, d.LogFile)
+	if err != nil {
+		return errors.New(csferr + err.Error())
+	}
+	d.cmd = cmd
+	var exitErr error
+	d.exited = watchProcess(cmd, &exitErr)
+	if err = probePort(ctx, d.address(), d.StartTimeout, d.exited); err != nil {
+		if err == ctx.Err() {
+			d.cmd.Process.Kill()
+			<-d.exited
+			d.cmd = nil
+			if d.logFile != nil {
+				d.logFile.Close()
+			}
+			return err
+		}
+		if err == errProcessExited {
+			//don't wait StartTimeout if the driver fails immediately (e.g. bad switches)
+			d.cmd = nil
+			if d.logFile != nil {
+				d.logFile.Close()
+			}
+			return startError(csferr+exitMessage(exitErr), stderr)
+		}
+		return startError(csferr+err.Error(), stderr)
+	}
+	if d.WaitReady {
+		return d.WaitForReady(d.StartTimeout)
+	}
+	return nil
+}
+
+//Return the version of the driver executable (e.g. "120.0.6099.109"), read from the output of its --version switch.
+func (d *chromiumDriver) Version() (string, error) {
+	if d.remote {
+		return "", errors.New("version: " + d.name + " is not run by this process")
+	}
+	return executableVersion(d.path)
+}
+
+//host:port of the driver.
+func (d *chromiumDriver) address() string {
+	return net.JoinHostPort(d.BindAddress, strconv.Itoa(d.Port))
+}
+
+//command line switches of the driver.
+func (d *chromiumDriver) switches() []string {
+	var switches []string
+	switches = append(switches, "-port="+strconv.Itoa(d.Port))
+	switches = append(switches, "-log-path="+d.LogPath)
+	switches = append(switches, "-http-threads="+strconv.Itoa(d.Threads))
+	if d.BaseUrl != "" {
+		switches = append(switches, "-url-base="+d.BaseUrl)
+	}
+	if d.AppendLog {
+		switches = append(switches, "-append-log")
+	}
+	if !isLoopback(d.BindAddress) {
+		//by default the driver accepts only local connections
+		switches = append(switches, "-allowed-ips=")
+	}
+	return switches
+}
+
+func (d *chromiumDriver) Stop() error {
+	if d.cmd == nil {
+		//never started or already stopped
+		return nil
+	}
+	defer func() {
+		d.cmd = nil
+	}()
+	d.cmd.Process.Signal(os.Interrupt)
+	if d.logFile != nil {
+		d.logFile.Close()
+	}
+	return nil
+}
+
+func (d *chromiumDriver) NewSession(desired, required Capabilities) (*Session, error) {
+	//id, capabs, err := d.newSession(desired, required)
+	//return &Session{id, capabs, d}, err
+	session, err := d.newSession(desired, required)
+	if err != nil {
+		return nil, err
+	}
+	session.wd = d
+	return session, nil
+}
+
+func (d *chromiumDriver) Sessions() ([]Session, error) {
+	sessions, err := d.sessions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].wd = d
+	}
+	return sessions, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testChromiumStartStop(t *testing.T, d *chromiumDriver) {
+	d.Port = freePort(t)
+	d.LogPath = filepath.Join(t.TempDir(), d.name+".log")
+	d.WaitReady = true
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := d.Status()
+	if err != nil {
+		t.Error(err)
+	} else if status.Message != "fake driver" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	exited := d.exited
+	if err = d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	<-exited
+	if err = d.Stop(); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+}
+
+func TestNewChromeDriverRemote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wd/status" {
+			http.NotFound(w, r)
+			return
+		}
+		writeMockResponse(w, http.StatusOK, 0, map[string]interface{}{"ready": true, "message": "remote driver"})
+	}))
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	d := NewChromeDriverRemote(addr.IP.String(), addr.Port)
+	d.BaseUrl = "/wd"
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if d.cmd != nil {
+		t.Fatal("a process has been started")
+	}
+	status, err := d.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Message != "remote driver" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if err = d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChromeDriverVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chromedriver")
+	script := "#!/bin/sh\necho 'ChromeDriver 120.0.6099.109 (3419140ab665596f21b385ce136419fde0924272-refs/branch-heads/6099@{#1483})'\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	version, err := NewChromeDriver(path).Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "120.0.6099.109" {
+		t.Fatalf("unexpected version: %q", version)
+	}
+	if _, err = NewChromeDriver(exitingDriver(t, "chromedriver", "broken", 1)).Version(); err == nil {
+		t.Fatal("Version should fail when the driver fails")
+	}
+	if _, err = NewChromeDriverRemote("127.0.0.1", 9515).Version(); err == nil {
+		t.Fatal("Version should fail for a remote driver")
+	}
+}
+
+func TestStopNotRunning(t *testing.T) {
+	drivers := []WebDriver{
+		NewChromeDriver("chromedriver"),
+		NewFirefoxDriver("firefox", "webdriver.xpi"),
+		NewSafariDriver(),
+	}
+	for _, d := range drivers {
+		if err := d.Stop(); err != nil {
+			t.Fatalf("%T: %v", d, err)
+		}
+	}
+}
+
+func TestChromeDriverStartStop(t *testing.T) {
+	d := NewChromeDriver(fakeDriver(t, "chromedriver"))
+	testChromiumStartStop(t, &d.chromiumDriver)
+}
+
+func TestEdgeDriverStartStop(t *testing.T) {
+	d := NewEdgeDriver(fakeDriver(t, "msedgedriver"))
+	testChromiumStartStop(t, &d.chromiumDriver)
+}
+
+func TestNewChromeDriverAuto(t *testing.T) {
+	path := fakeDriver(t, "chromedriver")
+	t.Setenv("PATH", filepath.Dir(path))
+	d, err := NewChromeDriverAuto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.path != path {
+		t.Fatalf("unexpected path: %s", d.path)
+	}
+	t.Setenv("PATH", t.TempDir())
+	locations := ChromeDriverLocations
+	defer func() { ChromeDriverLocations = locations }()
+	ChromeDriverLocations = []string{filepath.Join(t.TempDir(), "missing"), path}
+	if d, err = NewChromeDriverAuto(); err != nil || d.path != path {
+		t.Fatalf("chromedriver not found in locations: %v", err)
+	}
+	ChromeDriverLocations = nil
+	if _, err = NewChromeDriverAuto(); err == nil {
+		t.Fatal("NewChromeDriverAuto should fail")
+	}
+}
+
+func TestChromeDriverExitsEarly(t *testing.T) {
+	d := NewChromeDriver(exitingDriver(t, "chromedriver", "unknown switch", 3))
+	d.Port = freePort(t)
+	d.LogPath = filepath.Join(t.TempDir(), "chromedriver.log")
+	d.LogFile = filepath.Join(t.TempDir(), "output.log")
+	start := time.Now()
+	err := d.Start()
+	if err == nil {
+		d.Stop()
+		t.Fatal("Start should fail")
+	}
+	if !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "unknown switch") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Start waited %v for a process that exited", elapsed)
+	}
+	if d.cmd != nil {
+		t.Fatal("driver still marked as running")
+	}
+}
+
+func TestChromeDriverStartContext(t *testing.T) {
+	//a driver that never listens
+	path := filepath.Join(t.TempDir(), "chromedriver")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := NewChromeDriver(path)
+	d.Port = freePort(t)
+	d.LogPath = filepath.Join(t.TempDir(), "chromedriver.log")
+	d.StartTimeout = 30 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := d.StartContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("StartContext waited %v after the context expired", elapsed)
+	}
+	if d.cmd != nil {
+		t.Fatal("driver still marked as running")
+	}
+	select {
+	case <-d.exited:
+	default:
+		t.Fatal("driver process not reaped")
+	}
+}
+
+func TestChromeDriverLogOptions(t *testing.T) {
+	for _, truncate := range []bool{false, true} {
+		d := NewChromeDriver(fakeDriver(t, "chromedriver"))
+		d.Port = freePort(t)
+		d.LogPath = filepath.Join(t.TempDir(), "chromedriver.log")
+		if err := ioutil.WriteFile(d.LogPath, []byte("previous run\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		d.AppendLog = true
+		d.TruncateLogOnStart = truncate
+		if err := d.Start(); err != nil {
+			t.Fatal(err)
+		}
+		args := d.cmd.Args
+		exited := d.exited
+		d.Stop()
+		<-exited
+		if !strings.Contains(strings.Join(args, " "), "-append-log") {
+			t.Fatalf("missing -append-log: %v", args)
+		}
+		buf, err := ioutil.ReadFile(d.LogPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if truncate != (len(buf) == 0) {
+			t.Fatalf("TruncateLogOnStart=%v: unexpected log content %q", truncate, buf)
+		}
+	}
+}
+
+func TestChromeDriverBindAddress(t *testing.T) {
+	tests := []struct {
+		bind, address string
+		allowRemote   bool
+	}{
+		{"127.0.0.1", "127.0.0.1:9515", false},
+		{"localhost", "localhost:9515", false},
+		{"0.0.0.0", "0.0.0.0:9515", true},
+		{"::1", "[::1]:9515", false},
+		{"ci-runner.local", "ci-runner.local:9515", true},
+	}
+	for _, test := range tests {
+		d := NewChromeDriver("chromedriver")
+		d.BindAddress = test.bind
+		if address := d.address(); address != test.address {
+			t.Errorf("%s: unexpected address %s", test.bind, address)
+		}
+		allowRemote := strings.Contains(strings.Join(d.switches(), " "), "-allowed-ips=")
+		if allowRemote != test.allowRemote {
+			t.Errorf("%s: unexpected switches %v", test.bind, d.switches())
+		}
+	}
+	d := NewChromeDriver(fakeDriver(t, "chromedriver"))
+	d.Port = freePort(t)
+	d.LogPath = filepath.Join(t.TempDir(), "chromedriver.log")
+	d.BindAddress = "localhost"
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := d.exited
+	defer func() {
+		d.Stop()
+		<-exited
+	}()
+	if expected := fmt.Sprintf("http://localhost:%d", d.Port); d.url != expected {
+		t.Fatalf("unexpected url: %s", d.url)
+	}
+	if _, err := d.Status(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChromeDriverInvalidBindAddress(t *testing.T) {
+	d := NewChromeDriver(fakeDriver(t, "chromedriver"))
+	d.LogPath = filepath.Join(t.TempDir(), "chromedriver.log")
+	d.BindAddress = "bad host!"
+	err := d.Start()
+	if err == nil {
+		d.Stop()
+		t.Fatal("Start should fail")
+	}
+	if !strings.Contains(err.Error(), "invalid bind address") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
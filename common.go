@@ -6,12 +6,18 @@ package webdriver
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -70,6 +76,31 @@ var statusCodeStrings = map[int]string{
 	34: "Target provided for a move action is out of bounds.",
 }
 
+//W3C error codes with the matching JSON Wire Protocol status code.
+var w3cErrorCodes = map[string]int{
+	"invalid session id":        NoSuchDriver,
+	"no such element":           NoSuchElement,
+	"no such frame":             NoSuchFrame,
+	"unknown command":           UnknownCommand,
+	"unknown method":            UnknownCommand,
+	"stale element reference":   StaleElementReference,
+	"element not interactable":  ElementNotVisible,
+	"invalid element state":     InvalidElementState,
+	"unknown error":             UnknownError,
+	"element not selectable":    ElementIsNotSelectable,
+	"javascript error":          JavaScriptError,
+	"timeout":                   Timeout,
+	"no such window":            NoSuchWindow,
+	"invalid cookie domain":     InvalidCookieDomain,
+	"unable to set cookie":      UnableToSetCookie,
+	"unexpected alert open":     UnexpectedAlertOpen,
+	"no such alert":             NoAlertOpenError,
+	"script timeout":            ScriptTimeout,
+	"invalid selector":          InvalidSelector,
+	"session not created":       SessionNotCreatedException,
+	"move target out of bounds": MoveTargetOutOfBounds,
+}
+
 //type StatusErrorCode int
 
 type StackFrame struct {
@@ -82,10 +113,58 @@ type StackFrame struct {
 type CommandError struct {
 	StatusCode int
 	ErrorType  string
+	//W3C error code (e.g. "element click intercepted"), empty for JSON Wire Protocol errors.
+	Code       string `json:"error"`
 	Message    string
 	Screen     string
 	Class      string
 	StackTrace []StackFrame
+
+	//text of the unexpected alert, if reported by the server (see AlertText)
+	alertText *string
+}
+
+//Return the text of the alert that made the command fail with UnexpectedAlertOpen, when the server reports it.
+//W3C drivers send it in the "data" of the error, legacy drivers in the "alert" field of the value or only in the message (chromedriver).
+func (e *CommandError) AlertText() (string, bool) {
+	if e.StatusCode != UnexpectedAlertOpen || e.alertText == nil {
+		return "", false
+	}
+	return *e.alertText, true
+}
+
+//chromedriver reports the text only in the message: "unexpected alert open: {Alert text : hello}"
+const alertTextMarker = "{Alert text : "
+
+//look for the alert text in the value of an UnexpectedAlertOpen error.
+func (e *CommandError) parseAlertText(value json.RawMessage) {
+	if e.StatusCode != UnexpectedAlertOpen {
+		return
+	}
+	type alert struct {
+		Text *string `json:"text"`
+	}
+	var v struct {
+		Alert alert `json:"alert"`
+		Data  alert `json:"data"`
+	}
+	if json.Unmarshal(value, &v) == nil {
+		if v.Data.Text != nil {
+			e.alertText = v.Data.Text
+			return
+		}
+		if v.Alert.Text != nil {
+			e.alertText = v.Alert.Text
+			return
+		}
+	}
+	if i := strings.Index(e.Message, alertTextMarker); i >= 0 {
+		text := e.Message[i+len(alertTextMarker):]
+		if j := strings.LastIndex(text, "}"); j >= 0 {
+			text = text[:j]
+			e.alertText = &text
+		}
+	}
 }
 
 func (e CommandError) Error() string {
@@ -94,7 +173,9 @@ func (e CommandError) Error() string {
 	if m != "" {
 		m += ": "
 	}
-	if e.StatusCode == -1 {
+	if e.StatusCode == -1 && e.Code != "" {
+		m += e.Code + ": " + e.Message
+	} else if e.StatusCode == -1 {
 		m += "status code not specified"
 	} else if str, found := statusCodeStrings[e.StatusCode]; found {
 		m += str + ": " + e.Message
@@ -107,10 +188,38 @@ func (e CommandError) Error() string {
 //type matching the structure standard JSON object response.
 type jsonResponse struct {
 	RawSessionId json.RawMessage `json:"sessionId"`
-	Status       int             `json:"status"`
+	Status       jsonInt         `json:"status"`
 	RawValue     json.RawMessage `json:"value"`
 }
 
+//an int decoded from a JSON number or from a numeric string, that some nonconforming drivers send (e.g. "100").
+//Fractional values (e.g. the W3C element rect) are truncated.
+type jsonInt int
+
+func (i *jsonInt) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.New("invalid number: " + string(data))
+	}
+	*i = jsonInt(f)
+	return nil
+}
+
+//value of a W3C error response. The stack trace is a string, unlike the one of the JSON Wire Protocol (see CommandError.StackTrace).
+type w3cError struct {
+	Error      string          `json:"error"`
+	Message    string          `json:"message"`
+	Stacktrace string          `json:"stacktrace"`
+	Data       json.RawMessage `json:"data"`
+}
+
 func parseError(c int, jr jsonResponse) error {
 	var responseCodeError string
 	switch c {
@@ -130,23 +239,80 @@ func parseError(c int, jr jsonResponse) error {
 		responseCodeError = "Unknown error"
 	}
 	if jr.Status == 0 {
-		return &CommandError{StatusCode: -1, ErrorType: responseCodeError}
+		// W3C errors don't have a status but an error code in the value
+		commandError := &CommandError{StatusCode: -1, ErrorType: responseCodeError}
+		var value w3cError
+		if json.Unmarshal(jr.RawValue, &value) == nil {
+			commandError.Code = value.Error
+			commandError.Message = value.Message
+			if code, found := w3cErrorCodes[commandError.Code]; found {
+				commandError.StatusCode = code
+			}
+			commandError.parseAlertText(jr.RawValue)
+		}
+		return commandError
 	}
-	commandError := &CommandError{StatusCode: jr.Status, ErrorType: responseCodeError}
+	commandError := &CommandError{StatusCode: int(jr.Status), ErrorType: responseCodeError}
 	err := json.Unmarshal(jr.RawValue, commandError)
 	if err != nil {
 		// workaround: firefox could returns a string instead of a JSON object on errors
 		commandError.Message = string(jr.RawValue)
 	}
+	commandError.parseAlertText(jr.RawValue)
 	return commandError
 }
 
+//check if err is an HTTP 500 error that may not happen again: the body isn't a WebDriver error (e.g. it comes from an overloaded driver or a proxy)
+//or it is an "unknown error". Errors with a specific code (e.g. stale element reference or unexpected alert open) are deterministic.
+func isTransient500(err error) bool {
+	cerr, ok := err.(*CommandError)
+	if !ok || !strings.HasPrefix(cerr.ErrorType, "500:") {
+		return false
+	}
+	return (cerr.StatusCode == -1 && cerr.Code == "") || cerr.StatusCode == UnknownError
+}
+
+//check if err is a CommandError with the given status code.
+func isStatus(err error, statusCode int) bool {
+	cerr, ok := err.(*CommandError)
+	return ok && cerr.StatusCode == statusCode
+}
+
+//check if err reports a command or method not supported by the server (HTTP 404 or 405).
+func isUnknownCommand(err error) bool {
+	cerr, ok := err.(*CommandError)
+	if !ok {
+		return false
+	}
+	return cerr.StatusCode == UnknownCommand || strings.HasPrefix(cerr.ErrorType, "404:") || strings.HasPrefix(cerr.ErrorType, "405:")
+}
+
 func isRedirect(response *http.Response) bool {
-	r := response.StatusCode
-	return r == 302 || r == 303
+	switch response.StatusCode {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+//return the method used to follow a redirect: 307 and 308 preserve it, 303 changes it to GET
+//and 301 and 302 change POST to GET as browsers do.
+func redirectMethod(statusCode int, method string) string {
+	switch {
+	case statusCode == 303 && method != "GET":
+		return "GET"
+	case (statusCode == 301 || statusCode == 302) && method == "POST":
+		return "GET"
+	}
+	return method
+}
+
+//redirects are followed by doInternal, that knows the body of the request.
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
 }
 
-func newRequest(method, url string, data []byte) (*http.Request, error) {
+func (w WebDriverCore) newRequest(method, url string, data []byte) (*http.Request, error) {
 	request, err := http.NewRequest(method, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
@@ -154,32 +320,163 @@ func newRequest(method, url string, data []byte) (*http.Request, error) {
 	if method == "POST" {
 		request.Header.Add("Content-Type", "application/json;charset=utf-8")
 	}
-	//TODO add png format for screenshots
-	request.Header.Set("Accept", "application/json")
+	if w.PNGScreenshots && method == "GET" && strings.HasSuffix(url, "/screenshot") {
+		request.Header.Set("Accept", "image/png, application/json;q=0.9")
+	} else {
+		request.Header.Set("Accept", "application/json")
+	}
 	request.Header.Set("Accept-charset", "utf-8")
+	for name, value := range w.headers {
+		request.Header.Set(name, value)
+	}
+	if w.authHeader != "" {
+		request.Header.Set(w.authHeader, w.authValue)
+	}
 	return request, nil
 }
 
 type WebDriverCore struct {
+	//Ask the server to send screenshots as raw PNG images (Accept: image/png) instead of base64 encoded JSON strings. Servers that don't support it still reply with JSON. Default: false
+	PNGScreenshots bool
+	//Client used to communicate with the server. If nil a client with a dedicated transport configured with MaxIdleConnsPerHost and IdleConnTimeout is used.
+	//Its CheckRedirect is ignored, redirects are followed as configured by MaxRedirects. Default: nil
+	HTTPClient *http.Client
+	//Maximum number of redirects followed by a command. 307 and 308 redirects are followed with the same method and body,
+	//303 with GET, 301 and 302 with GET if the method is POST. 0 means 10, a negative value disables redirects. Default: 0
+	MaxRedirects int
+	//Maximum number of idle (keep-alive) connections kept open with the server. Default: 16
+	MaxIdleConnsPerHost int
+	//Time an idle (keep-alive) connection is kept open. Default: 90s
+	IdleConnTimeout time.Duration
+	//Maximum time a command can take before it is aborted, 0 means no limit.
+	//Commands that legitimately take long (e.g. ExecuteScriptAsync, page loads with Url) must fit in it, so it should be longer than the script and page load timeouts of the session. Default: 0
+	CommandTimeout time.Duration
+	//Called after every command, also when it fails, with the HTTP status code of the last response (0 if no response has been received) and the time the command took.
+	//A command is reported once, including its redirects and retries (see GetRetries). It can be used to collect command latencies.
+	OnCommand func(method, url string, status int, dur time.Duration, err error)
+	//Number of times the request creating a session is retried when the server refuses the connection or fails with an HTTP 500 that is not a WebDriver error,
+	//e.g. because the driver is still starting. 0 means 3, a negative value disables the retries. Default: 0
+	SessionCreateRetries int
+	//Number of times a GET command is retried when the server fails with HTTP 500, as chromedriver occasionally does under load.
+	//Only "unknown error" and responses that aren't WebDriver errors are retried, other errors (e.g. stale element reference) wouldn't change.
+	//Other methods are never retried since they may not be idempotent. Default: 0 (no retries)
+	GetRetries int
+	//Time waited before the first retry of a GET command, the n-th retry waits n times as long. 0 means 100ms. Default: 0
+	GetRetryBackoff time.Duration
+	//Report the request and response bodies to the command logger as indented JSON instead of a single line. Default: false
+	PrettyDebug bool
+	//Maximum number of bytes of each body reported to the command logger, 0 means 1024 bytes, or no limit if PrettyDebug is set. Default: 0
+	DebugBodyLimit int
+
 	url string
+	//header used to authenticate on the server (see SetBasicAuth and SetAuthHeader)
+	authHeader, authValue string
+	//custom headers sent with every request (see SetHeader)
+	headers map[string]string
+	//receives a record for every command (see SetCommandLogger)
+	logger CommandLogger
+}
+
+//Send a custom header with every request (e.g. "X-Build-Id" for request correlation).
+//Headers must not be changed while commands are running.
+func (w *WebDriverCore) SetHeader(name, value string) {
+	if w.headers == nil {
+		w.headers = map[string]string{}
+	}
+	w.headers[name] = value
+}
+
+//Stop sending a header set with SetHeader.
+func (w *WebDriverCore) RemoveHeader(name string) {
+	delete(w.headers, name)
+}
+
+//Authenticate every request with HTTP basic authentication (e.g. to use a Selenium Grid behind an authenticating proxy).
+func (w *WebDriverCore) SetBasicAuth(user, password string) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	w.SetAuthHeader("Authorization", "Basic "+credentials)
+}
+
+//Authenticate every request with a custom header (e.g. "Authorization", "Bearer <token>").
+//The header is never reported to the command logger.
+func (w *WebDriverCore) SetAuthHeader(name, value string) {
+	w.authHeader = name
+	w.authValue = value
+}
+
+//key of the transports cache.
+type transportSettings struct {
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = map[transportSettings]*http.Transport{}
+)
+
+//return the client used to communicate with the server, transports are reused to keep connections alive between commands.
+func (w WebDriverCore) client() *http.Client {
+	if w.HTTPClient != nil {
+		client := *w.HTTPClient
+		client.CheckRedirect = noRedirect
+		return &client
+	}
+	settings := transportSettings{w.MaxIdleConnsPerHost, w.IdleConnTimeout}
+	if settings.maxIdleConnsPerHost == 0 {
+		settings.maxIdleConnsPerHost = 16
+	}
+	if settings.idleConnTimeout == 0 {
+		settings.idleConnTimeout = 90 * time.Second
+	}
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	transport, found := transports[settings]
+	if !found {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = settings.maxIdleConnsPerHost
+		transport.IdleConnTimeout = settings.idleConnTimeout
+		transports[settings] = transport
+	}
+	return &http.Client{Transport: transport, CheckRedirect: noRedirect}
 }
 
 func (w WebDriverCore) Start() error { return nil }
 func (w WebDriverCore) Stop() error  { return nil }
 
 func (w WebDriverCore) do(params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error) {
+	return w.doContext(context.Background(), params, method, urlFormat, urlParams...)
+}
+
+//like do, the request is aborted when ctx is done or CommandTimeout expires.
+func (w WebDriverCore) doContext(ctx context.Context, params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error) {
 	if method != "GET" && method != "POST" && method != "DELETE" {
 		return "", nil, errors.New("invalid method: " + method)
 	}
+	if w.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.CommandTimeout)
+		defer cancel()
+	}
 	url := w.url + fmt.Sprintf(urlFormat, urlParams...)
-	return w.doInternal(params, method, url)
+	//the command is reported once, also when it is redirected or retried
+	start := time.Now()
+	var last roundTrip
+	sessionId, data, err := w.doInternal(ctx, params, method, url, 0, 0, &last)
+	w.logCommand(method, url, last.statusCode, sessionId, start, last.request, last.response, err)
+	return sessionId, data, err
 }
 
-//communicate with the server.
-func (w WebDriverCore) doInternal(params interface{}, method, url string) (string, []byte, error) {
-	debugprint(">> " + method + " " + url)
+//the last request sent by doInternal for a command, reported by logCommand.
+type roundTrip struct {
+	statusCode        int
+	request, response []byte
+}
+
+//communicate with the server, redirects is the number of redirects already followed and retries the number of times the command has been retried (see GetRetries).
+func (w WebDriverCore) doInternal(ctx context.Context, params interface{}, method, url string, redirects, retries int, last *roundTrip) (sessionId string, data []byte, err error) {
+	*last = roundTrip{}
 	var jsonParams []byte
-	var err error
 	if method == "POST" {
 		if params == nil {
 			params = map[string]interface{}{}
@@ -188,35 +485,46 @@ func (w WebDriverCore) doInternal(params interface{}, method, url string) (strin
 		if err != nil {
 			return "", nil, err
 		}
+		last.request = jsonParams
 	}
-	request, err := newRequest(method, url, jsonParams)
+	request, err := w.newRequest(method, url, jsonParams)
 	if err != nil {
 		return "", nil, err
 	}
-	response, err := http.DefaultClient.Do(request)
+	response, err := w.client().Do(request.WithContext(ctx))
 	if err != nil {
 		return "", nil, err
 	}
-	debugprint("StatusCode: " + strconv.Itoa(response.StatusCode))
-	//http.Client doesn't follow POST redirected (/session command)
-	if method == "POST" && isRedirect(response) {
-		debugprint("redirected")
+	defer response.Body.Close()
+	last.statusCode = response.StatusCode
+	if isRedirect(response) {
+		maxRedirects := w.MaxRedirects
+		if maxRedirects == 0 {
+			maxRedirects = 10
+		}
+		if redirects >= maxRedirects {
+			return "", nil, fmt.Errorf("redirect: stopped after %d redirects", redirects)
+		}
 		url, err := response.Location()
 		if err != nil {
-			return "", nil, err
+			return "", nil, errors.New("redirect: " + err.Error())
+		}
+		redirectedMethod := redirectMethod(response.StatusCode, method)
+		if redirectedMethod != method {
+			params = nil
 		}
-		return w.doInternal(nil, "GET", url.String())
+		return w.doInternal(ctx, params, redirectedMethod, url.String(), redirects+1, retries, last)
 	}
 
-	buf, err := ioutil.ReadAll(response.Body)
+	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return "", nil, err
 	}
-	head := string(buf)
-	if len(buf) > 1024 {
-		head = fmt.Sprintf("%s ...%d more bytes", string(buf[0:1024]), len(buf)-1024)
+	if response.StatusCode == 200 && strings.HasPrefix(response.Header.Get("Content-Type"), "image/png") {
+		return "", body, nil
 	}
-	debugprint("<< " + head)
+	buf := body
+	last.response = body
 
 	jr := &jsonResponse{}
 	err = json.Unmarshal(buf, jr)
@@ -227,9 +535,22 @@ func (w WebDriverCore) doInternal(params interface{}, method, url string) (strin
 	//	return "", nil, errors.New("error: response must be a JSON object: "+err.Error())
 	//}
 	if response.StatusCode >= 400 || jr.Status != 0 {
-		return "", nil, parseError(response.StatusCode, *jr)
+		err = parseError(response.StatusCode, *jr)
+		if method == "GET" && retries < w.GetRetries && isTransient500(err) {
+			backoff := w.GetRetryBackoff
+			if backoff == 0 {
+				backoff = 100 * time.Millisecond
+			}
+			select {
+			case <-time.After(time.Duration(retries+1) * backoff):
+			case <-ctx.Done():
+				return "", nil, ctx.Err()
+			}
+			return w.doInternal(ctx, params, method, url, redirects, retries+1, last)
+		}
+		return "", nil, err
 	}
-	sessionId := string(bytes.Trim(jr.RawSessionId, "{}\""))
+	sessionId = string(bytes.Trim(jr.RawSessionId, "{}\""))
 	return sessionId, []byte(jr.RawValue), nil
 }
 
@@ -239,11 +560,29 @@ func (w WebDriverCore) Status() (*Status, error) {
 	if err != nil {
 		return nil, err
 	}
-	status := &Status{}
+	status := &Status{Ready: true}
 	err = json.Unmarshal(data, status)
 	return status, err
 }
 
+//Poll the server's status until it is ready or timeout expires.
+func (w WebDriverCore) WaitForReady(timeout time.Duration) error {
+	start := time.Now()
+	for {
+		status, err := w.Status()
+		if err == nil && status.Ready {
+			return nil
+		}
+		if time.Since(start) > timeout {
+			if err == nil {
+				return errors.New("wait for ready failed: " + status.Message)
+			}
+			return errors.New("wait for ready failed: " + err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 //Create a new session.
 //The server should attempt to create a session that most closely matches the desired and required capabilities. Required capabilities have higher priority than desired capabilities and must be set for the session to be created.
 func (w WebDriverCore) newSession(desired, required Capabilities) (*Session, error) {
@@ -251,13 +590,93 @@ func (w WebDriverCore) newSession(desired, required Capabilities) (*Session, err
 		desired = map[string]interface{}{}
 	}
 	p := params{"desiredCapabilities": desired, "requiredCapabilities": required}
-	sessionId, data, err := w.do(p, "POST", "/session")
+	sessionId, data, err := w.createSession(context.Background(), p)
 	if err != nil {
 		return nil, err
 	}
+	return decodeNewSession(sessionId, data)
+}
+
+//decode the value of the new session response. W3C drivers nest the capabilities in it together with the session id
+//({"sessionId": ..., "capabilities": {...}}), legacy drivers return the capabilities flat and the session id next to the value.
+func decodeNewSession(sessionId string, data []byte) (*Session, error) {
+	var value struct {
+		SessionId    string          `json:"sessionId"`
+		Capabilities json.RawMessage `json:"capabilities"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, errors.New("new session: " + err.Error())
+	}
+	if value.Capabilities != nil && string(value.Capabilities) != "null" {
+		var capabilities Capabilities
+		if err := json.Unmarshal(value.Capabilities, &capabilities); err != nil {
+			return nil, errors.New("new session: " + err.Error())
+		}
+		//W3C drivers send the session id only in the value
+		if value.SessionId != "" {
+			sessionId = value.SessionId
+		}
+		return &Session{Id: sessionId, Capabilities: capabilities, W3C: true, rawCapabilities: value.Capabilities}, nil
+	}
 	var capabilities Capabilities
-	err = json.Unmarshal(data, &capabilities)
-	return &Session{Id: sessionId, Capabilities: capabilities}, err
+	if err := json.Unmarshal(data, &capabilities); err != nil {
+		return nil, errors.New("new session: " + err.Error())
+	}
+	return &Session{Id: sessionId, Capabilities: capabilities, rawCapabilities: data}, nil
+}
+
+//Create a new session with the W3C protocol.
+//Required capabilities are sent as "alwaysMatch" and desired capabilities as the only "firstMatch" entry.
+func (w WebDriverCore) newW3CSession(desired, required Capabilities) (*Session, error) {
+	if desired == nil {
+		desired = map[string]interface{}{}
+	}
+	if required == nil {
+		required = map[string]interface{}{}
+	}
+	p := params{"capabilities": params{"alwaysMatch": required, "firstMatch": []Capabilities{desired}}}
+	sessionId, data, err := w.createSession(context.Background(), p)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNewSession(sessionId, data)
+}
+
+//send the request creating a session, retrying it as configured by SessionCreateRetries.
+//The attempts and the waits between them are aborted when ctx is done or CommandTimeout expires.
+func (w WebDriverCore) createSession(ctx context.Context, p params) (string, []byte, error) {
+	retries := w.SessionCreateRetries
+	if retries == 0 {
+		retries = 3
+	}
+	if w.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.CommandTimeout)
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		sessionId, data, err := w.doContext(ctx, p, "POST", "/session")
+		if err == nil || attempt > retries || !isSessionCreateRetryable(err) {
+			return sessionId, data, err
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+}
+
+//check if err is a connection refused or an HTTP 500 error whose body isn't a WebDriver error, that a driver that is still starting may return.
+//WebDriver errors are not retried: the driver may have launched a browser before failing (that a new attempt would leave behind)
+//or the failure is permanent (e.g. "session not created" because of a missing browser binary or mismatched versions).
+func isSessionCreateRetryable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	cerr, ok := err.(*CommandError)
+	return ok && strings.HasPrefix(cerr.ErrorType, "500:") && cerr.StatusCode == -1 && cerr.Code == ""
 }
 
 //Returns a list of the currently active sessions.
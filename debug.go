@@ -0,0 +1,59 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//Save the current page source in a file.
+func (s Session) SaveSource(path string) error {
+	source, err := s.Source()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(source), 0644)
+}
+
+//Save the current page source, a screenshot, the current URL and the browser logs in a new directory inside dir named after the current time.
+//All the files are written even if some of them fail, in which case the first error is returned.
+func (s Session) SaveDebugBundle(dir string) error {
+	dir = filepath.Join(dir, time.Now().Format("20060102-150405.000"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var firstErr error
+	check := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	check(s.SaveSource(filepath.Join(dir, "source.html")))
+	if screenshot, err := s.Screenshot(); err == nil {
+		check(ioutil.WriteFile(filepath.Join(dir, "screenshot.png"), screenshot, 0644))
+	} else {
+		check(err)
+	}
+	if url, err := s.GetUrl(); err == nil {
+		check(ioutil.WriteFile(filepath.Join(dir, "url.txt"), []byte(url+"\n"), 0644))
+	} else {
+		check(err)
+	}
+	if entries, err := s.Log("browser"); err == nil {
+		var buf bytes.Buffer
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "%d %s %s\n", e.TimeStamp, e.Level, e.Message)
+		}
+		check(ioutil.WriteFile(filepath.Join(dir, "browser.log"), buf.Bytes(), 0644))
+	} else {
+		check(err)
+	}
+	return firstErr
+}
@@ -0,0 +1,62 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mockScreenshot(t *testing.T) string {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestSaveDebugBundle(t *testing.T) {
+	screenshot := mockScreenshot(t)
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		switch r.Path {
+		case "/session/mock/source":
+			return "<html><body>mock</body></html>"
+		case "/session/mock/screenshot":
+			return screenshot
+		case "/session/mock/url":
+			return "http://example.com/"
+		case "/session/mock/log":
+			return []LogEntry{{1, "SEVERE", "mock error"}}
+		}
+		return nil
+	})
+	dir, err := ioutil.TempDir("", "webdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = s.SaveDebugBundle(dir); err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(bundles) != 1 {
+		t.Fatalf("expected a single bundle directory: %v %v", bundles, err)
+	}
+	for _, name := range []string{"source.html", "screenshot.png", "url.txt", "browser.log"} {
+		info, err := os.Stat(filepath.Join(bundles[0], name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Fatalf("%s is empty", name)
+		}
+	}
+}
@@ -27,4 +27,7 @@
 //	session.Delete()
 //	chromeDriver.Stop()
 //
+// NewChromeDriverAuto finds chromedriver without an explicit path:
+//	chromeDriver, err := webdriver.NewChromeDriverAuto()
+//
 package webdriver
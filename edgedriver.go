@@ -0,0 +1,30 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+//A driver for Microsoft Edge (Chromium) using msedgedriver.
+//Msedgedriver is built from chromedriver and accepts the same switches.
+type EdgeDriver struct {
+	chromiumDriver
+}
+
+//create a new service using msedgedriver.
+func NewEdgeDriver(path string) *EdgeDriver {
+	return &EdgeDriver{newChromiumDriver("msedgedriver", path)}
+}
+
+//Edge specific capabilities. Edge accepts the same options as Chrome (see ChromeOptions).
+type EdgeOptions struct {
+	ChromeOptions
+}
+
+//Return the capabilities matching the options, the options are sent as "ms:edgeOptions".
+func (o *EdgeOptions) Capabilities() Capabilities {
+	c := Capabilities{"ms:edgeOptions": toJSONMap(o.ChromeOptions)}
+	if len(o.LoggingPrefs) > 0 {
+		c["ms:loggingPrefs"] = toJSONMap(o.LoggingPrefs)
+	}
+	return c
+}
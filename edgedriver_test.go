@@ -0,0 +1,41 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEdgeStartStop(t *testing.T) {
+	if *target != "edge" {
+		t.Skip("requires -target=edge")
+	}
+	d := NewEdgeDriver(*wdpath)
+	d.Port = 9516
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Status(); err != nil {
+		t.Error(err)
+	}
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEdgeOptions(t *testing.T) {
+	options := &EdgeOptions{}
+	options.Args = []string{"--headless"}
+	options.SetDownloadDir("/tmp/downloads", nil)
+	buf, err := json.Marshal(options.Capabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"ms:edgeOptions":{"args":["--headless"],"prefs":{"download.default_directory":"/tmp/downloads","download.prompt_for_download":false}}}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected capabilities: %s", buf)
+	}
+}
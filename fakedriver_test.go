@@ -0,0 +1,94 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//write an executable script that runs the test binary as a fake driver (see TestFakeDriver).
+func fakeDriver(t *testing.T, name string) string {
+	self, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	script := fmt.Sprintf("#!/bin/sh\nGO_WANT_FAKE_DRIVER=1 exec %q -test.run='^TestFakeDriver$' -- \"$@\"\n", self)
+	if err = ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+//write a script that prints message on stderr and exits with code, like a driver that fails to start.
+func exitingDriver(t *testing.T, name, message string, code int) string {
+	path := filepath.Join(t.TempDir(), name)
+	script := fmt.Sprintf("#!/bin/sh\necho %q >&2\nexit %d\n", message, code)
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+//write a script that keeps running without listening on its port, like a driver that hangs while starting.
+func hangingDriver(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+//parse the port from the arguments in the forms -port=N, --port=N or --port N.
+func fakeDriverPort(args []string) string {
+	for i, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(arg, "port=") {
+			return arg[len("port="):]
+		}
+		if arg == "port" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+//Not a real test: it is run as a subprocess by the fake driver script and serves the status command.
+func TestFakeDriver(t *testing.T) {
+	if os.Getenv("GO_WANT_FAKE_DRIVER") != "1" {
+		return
+	}
+	var args []string
+	for i, arg := range os.Args {
+		if arg == "--" {
+			args = os.Args[i+1:]
+			break
+		}
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:"+fakeDriverPort(args))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMockResponse(w, 200, 0, map[string]interface{}{"ready": true, "message": "fake driver"})
+	}))
+	os.Exit(0)
+}
+
+func freePort(t *testing.T) int {
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
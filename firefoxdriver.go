@@ -6,39 +6,53 @@ package webdriver
 
 import (
 	"archive/zip"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type FirefoxDriver struct {
 	WebDriverCore
-	// The port firefox webdriver listens on. This port - 1 will be used as a mutex to avoid starting multiple firefox instances listening to the same port. Default: 7055
+	// The port firefox webdriver listens on. If 0 Start chooses a free port and locks it until firefox listens on it, so that multiple instances can run in parallel;
+	// the chosen port is set in Port until Stop. Default: 0 (it used to be 7055, set it explicitly to keep listening on that port)
 	Port int
-	// Start method fails if lock (see Port) is not acquired before LockPortTimeout. Default 60s
+	// Start method fails if a free port (see Port) can't be locked before LockPortTimeout. Default 60s
 	LockPortTimeout time.Duration
 	// Start method fails if Firefox doesn't start in less than StartTimeout. Default 20s.
 	StartTimeout time.Duration
+	// If true Start waits until firefox replies to the status command (see WaitForReady). Default false.
+	WaitReady bool
 	// Log file to dump firefox stdout/stderr. If "" send to terminal. Default: ""
 	LogFile string
 	// Firefox preferences. Default: see method GetDefaultPrefs
 	Prefs map[string]interface{}
 	// If temporary profile has to be deleted when closing. Default: true
 	DeleteProfileOnClose bool
+	// Path of the firefox binary, it overrides the path passed to NewFirefoxDriver (e.g. to switch between ESR and Nightly builds). Default: ""
+	BinaryPath string
+	// Run firefox without a display server (-headless flag). Screenshots are still available. Default: false
+	Headless bool
+	// Additional command line arguments passed to firefox. Default: none
+	ExtraArgs []string
+	// Environment variables set for firefox in addition to the ones of the current process (e.g. "MOZ_HEADLESS": "1" or "DISPLAY": ":1"). Default: none
+	Env map[string]string
 
 	firefoxPath string
 	xpiPath     string
 	profilePath string
 	cmd         *exec.Cmd
 	logFile     *os.File
+	//Port has been chosen by Start and is reset by Stop
+	autoPort bool
 }
 
 func NewFirefoxDriver(firefoxPath string, xpiPath string) *FirefoxDriver {
@@ -66,33 +80,37 @@ func (d *FirefoxDriver) SetLogPath(path string) {
 	d.Prefs["webdriver.log.browser.file"] = filepath.Join(path, "browser.log")
 }
 
+//Save downloaded files in path without asking.
+//mimeTypes is the list of content types (e.g. "application/pdf") that are saved to disk instead of being opened by firefox.
+func (d *FirefoxDriver) SetDownloadDir(path string, mimeTypes []string) {
+	d.Prefs["browser.download.dir"] = path
+	d.Prefs["browser.download.folderList"] = 2
+	d.Prefs["browser.helperApps.neverAsk.saveToDisk"] = strings.Join(mimeTypes, ",")
+}
+
+//Send the given User-Agent string, equivalent to setting the "general.useragent.override" preference.
+func (d *FirefoxDriver) SetUserAgent(ua string) {
+	d.Prefs["general.useragent.override"] = ua
+}
+
+//Send the given language (e.g. "fr-FR") in the Accept-Language header, equivalent to setting the "intl.accept_languages" preference.
+func (d *FirefoxDriver) SetLanguage(lang string) {
+	d.Prefs["intl.accept_languages"] = lang
+}
+
 func (d *FirefoxDriver) Start() error {
+	if _, err := exec.LookPath(d.binary()); err != nil {
+		return errors.New("unable to start firefox: invalid binary: " + err.Error())
+	}
 	if d.Port == 0 { //otherwise try to use that port
-		d.Port = 7055
-		lockPortAddress := fmt.Sprintf("127.0.0.1:%d", d.Port-1)
-		now := time.Now()
-		//try to lock port d.Port - 1
-		for {
-			if ln, err := net.Listen("tcp", lockPortAddress); err == nil {
-				defer ln.Close()
-				break
-			}
-			if time.Since(now) > d.LockPortTimeout {
-				return errors.New("timeout expired trying to lock mutex port")
-			}
-			time.Sleep(1 * time.Second)
-		}
-		//find the first available port starting with d.Port
-		for i := d.Port; i < 65535; i++ {
-			address := fmt.Sprintf("127.0.0.1:%d", i)
-			if ln, err := net.Listen("tcp", address); err == nil {
-				if err = ln.Close(); err != nil {
-					return err
-				}
-				d.Port = i
-				break
-			}
+		port, release, err := lockFreePort(d.LockPortTimeout)
+		if err != nil {
+			return errors.New("unable to find a free port: " + err.Error())
 		}
+		//the lock is held until firefox listens on the port (or fails to)
+		defer release()
+		d.Port = port
+		d.autoPort = true
 	}
 	//start firefox with custom profile
 	//TODO it should be possible to use an existing profile
@@ -100,42 +118,61 @@ func (d *FirefoxDriver) Start() error {
 	var err error
 	d.profilePath, err = createTempProfile(d.xpiPath, d.Prefs)
 	if err != nil {
+		d.resetPort()
 		return err
 	}
 	debugprint(d.profilePath)
-	d.cmd = exec.Command(d.firefoxPath, "-no-remote", "-profile", d.profilePath)
-	stdout, err := d.cmd.StdoutPipe()
-	if err != nil {
-		fmt.Println(err)
-	}
-	stderr, err := d.cmd.StderrPipe()
+	cmd := d.command()
+	var stderr *tailBuffer
+	d.logFile, stderr, err = runBrowser(cmd, d.LogFile)
 	if err != nil {
-		fmt.Println(err)
-	}
-	if err := d.cmd.Start(); err != nil {
+		d.resetPort()
 		return errors.New("unable to start firefox: " + err.Error())
 	}
-	if d.LogFile != "" {
-		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
-		d.logFile, err = os.OpenFile(d.LogFile, flags, 0640)
-		if err != nil {
-			return err
-		}
-		go io.Copy(d.logFile, stdout)
-		go io.Copy(d.logFile, stderr)
-	} else {
-		go io.Copy(os.Stdout, stdout)
-		go io.Copy(os.Stderr, stderr)
-	}
+	d.cmd = cmd
+	var exitErr error
+	exited := watchProcess(cmd, &exitErr)
 	//probe d.Port until firefox replies or StartTimeout is up
-	if err = probePort(d.Port, d.StartTimeout); err != nil {
-		return err
+	if err = probePort(context.Background(), fmt.Sprintf("127.0.0.1:%d", d.Port), d.StartTimeout, exited); err != nil {
+		if err == errProcessExited {
+			d.cmd = nil
+			if d.logFile != nil {
+				d.logFile.Close()
+			}
+			if d.DeleteProfileOnClose {
+				os.RemoveAll(d.profilePath)
+			}
+			d.resetPort()
+			return startError("unable to start firefox: "+exitMessage(exitErr), stderr)
+		}
+		return startError(err.Error(), stderr)
 	}
 
 	d.url = fmt.Sprintf("http://127.0.0.1:%d/hub", d.Port)
+	if d.WaitReady {
+		return d.WaitForReady(d.StartTimeout)
+	}
 	return nil
 }
 
+//path of the firefox binary.
+func (d *FirefoxDriver) binary() string {
+	if d.BinaryPath != "" {
+		return d.BinaryPath
+	}
+	return d.firefoxPath
+}
+
+//build the command to start firefox with the temporary profile.
+func (d *FirefoxDriver) command() *exec.Cmd {
+	args := []string{"-no-remote", "-profile", d.profilePath}
+	if d.Headless {
+		args = append(args, "-headless")
+	}
+	args = append(args, d.ExtraArgs...)
+	return newCommand(d.binary(), args, d.Env)
+}
+
 // Populate a map with default firefox preferences
 func GetDefaultPrefs() map[string]interface{} {
 	prefs := map[string]interface{}{
@@ -329,7 +366,8 @@ func writeExtensionFile(f *zip.File, extPath string) error {
 
 func (d *FirefoxDriver) Stop() error {
 	if d.cmd == nil {
-		return errors.New("stop failed: firefoxdriver not running")
+		//never started or already stopped
+		return nil
 	}
 	defer func() {
 		d.cmd = nil
@@ -341,9 +379,18 @@ func (d *FirefoxDriver) Stop() error {
 	if d.DeleteProfileOnClose {
 		os.RemoveAll(d.profilePath)
 	}
+	d.resetPort()
 	return nil
 }
 
+//forget the port chosen by Start, so that the next Start chooses a free one again.
+func (d *FirefoxDriver) resetPort() {
+	if d.autoPort {
+		d.Port = 0
+		d.autoPort = false
+	}
+}
+
 func (d *FirefoxDriver) NewSession(desired, required Capabilities) (*Session, error) {
 	session, err := d.newSession(desired, required)
 	if err != nil {
@@ -0,0 +1,177 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirefoxSetDownloadDir(t *testing.T) {
+	d := NewFirefoxDriver("firefox", "webdriver.xpi")
+	d.SetDownloadDir("/tmp/downloads", []string{"application/pdf", "text/csv"})
+	expected := map[string]interface{}{
+		"browser.download.dir":                   "/tmp/downloads",
+		"browser.download.folderList":            2,
+		"browser.helperApps.neverAsk.saveToDisk": "application/pdf,text/csv",
+	}
+	for k, v := range expected {
+		if d.Prefs[k] != v {
+			t.Errorf("pref %s = %v, want %v", k, d.Prefs[k], v)
+		}
+	}
+}
+
+func TestLockFreePort(t *testing.T) {
+	ports := map[int]bool{}
+	var releases []func()
+	for i := 0; i < 5; i++ {
+		port, release, err := lockFreePort(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+		if ports[port] {
+			t.Fatalf("port %d locked twice", port)
+		}
+		ports[port] = true
+	}
+	for _, release := range releases {
+		release()
+	}
+	for port := range ports {
+		if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("webdriver-port-%d.lock", port))); !os.IsNotExist(err) {
+			t.Fatalf("lock of port %d not released: %v", port, err)
+		}
+	}
+}
+
+func TestFirefoxStartResetsPort(t *testing.T) {
+	d := NewFirefoxDriver(exitingDriver(t, "firefox", "", 1), filepath.Join(t.TempDir(), "missing.xpi"))
+	if err := d.Start(); err == nil {
+		d.Stop()
+		t.Fatal("Start should fail")
+	}
+	if d.Port != 0 {
+		t.Fatalf("chosen port not reset: %d", d.Port)
+	}
+	d.Port = 7055
+	if err := d.Start(); err == nil {
+		d.Stop()
+		t.Fatal("Start should fail")
+	}
+	if d.Port != 7055 {
+		t.Fatalf("configured port changed: %d", d.Port)
+	}
+}
+
+func TestFirefoxSetUserAgent(t *testing.T) {
+	d := NewFirefoxDriver("firefox", "webdriver.xpi")
+	d.SetUserAgent("webdriver agent")
+	if ua := d.Prefs["general.useragent.override"]; ua != "webdriver agent" {
+		t.Fatalf("unexpected user agent pref: %v", ua)
+	}
+}
+
+func TestFirefoxSetLanguage(t *testing.T) {
+	d := NewFirefoxDriver("firefox", "webdriver.xpi")
+	d.SetLanguage("fr-FR")
+	if lang := d.Prefs["intl.accept_languages"]; lang != "fr-FR" {
+		t.Fatalf("unexpected language pref: %v", lang)
+	}
+}
+
+func TestFirefoxCommand(t *testing.T) {
+	d := NewFirefoxDriver("/opt/firefox/firefox", "webdriver.xpi")
+	d.profilePath = "/tmp/profile"
+	d.Headless = true
+	d.ExtraArgs = []string{"-safe-mode"}
+	d.Env = map[string]string{"MOZ_HEADLESS": "1", "DISPLAY": ":1"}
+	cmd := d.command()
+	expected := []string{"/opt/firefox/firefox", "-no-remote", "-profile", "/tmp/profile", "-headless", "-safe-mode"}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Fatalf("unexpected args: %v", cmd.Args)
+	}
+	env := cmd.Env[len(cmd.Env)-2:]
+	if !reflect.DeepEqual(env, []string{"DISPLAY=:1", "MOZ_HEADLESS=1"}) {
+		t.Fatalf("unexpected env: %v", env)
+	}
+}
+
+func TestFirefoxHeadless(t *testing.T) {
+	if *target != "firefox" {
+		t.Skip("requires -target=firefox")
+	}
+	checkServer(t)
+	d := NewFirefoxDriver("firefox", *wdpath)
+	d.Headless = true
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+	s, err := d.NewSession(Capabilities{}, Capabilities{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete()
+	if err = s.Url(getUrl("simple")); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := s.Screenshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = png.Decode(bytes.NewBuffer(buf)); err != nil {
+		t.Fatal("returned data is not a png image: " + err.Error())
+	}
+}
+
+func TestFirefoxParallel(t *testing.T) {
+	if *target != "firefox" {
+		t.Skip("requires -target=firefox")
+	}
+	drivers := []*FirefoxDriver{NewFirefoxDriver("firefox", *wdpath), NewFirefoxDriver("firefox", *wdpath)}
+	errs := make(chan error, len(drivers))
+	for _, d := range drivers {
+		d.Headless = true
+		go func(d *FirefoxDriver) {
+			errs <- d.Start()
+		}(d)
+	}
+	for range drivers {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	for _, d := range drivers {
+		defer d.Stop()
+	}
+	if drivers[0].Port == 0 || drivers[0].Port == drivers[1].Port {
+		t.Fatalf("drivers are not listening on distinct ports: %d, %d", drivers[0].Port, drivers[1].Port)
+	}
+}
+
+func TestFirefoxBinaryPath(t *testing.T) {
+	d := NewFirefoxDriver("firefox", "webdriver.xpi")
+	d.BinaryPath = "/nonexistent/firefox-nightly"
+	if cmd := d.command(); cmd.Path != d.BinaryPath {
+		t.Fatalf("BinaryPath not used: %s", cmd.Path)
+	}
+	err := d.Start()
+	if err == nil {
+		d.Stop()
+		t.Fatal("Start must fail with a nonexistent binary")
+	}
+	if !strings.Contains(err.Error(), "invalid binary") || !strings.Contains(err.Error(), d.BinaryPath) {
+		t.Fatalf("error is not descriptive: %v", err)
+	}
+}
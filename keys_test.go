@@ -0,0 +1,29 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChord(t *testing.T) {
+	chord := Chord(KeyControl, KeyShift, "a")
+	if !strings.HasSuffix(chord, "\uE000") {
+		t.Fatalf("chord %q is not terminated by the null key", chord)
+	}
+	if !strings.HasPrefix(chord, KeyControl+KeyShift+"a") {
+		t.Fatalf("chord %q doesn't contain the joined keys", chord)
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	keys := splitKeys(Chord(KeyControl, "aè"))
+	expected := []string{KeyControl, "a", "è", KeyNull}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("unexpected keys: %q", keys)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+//order of the log levels, from the most to the least verbose.
+var logLevelRank = map[LogLevel]int{
+	LogAll:     0,
+	LogDebug:   1,
+	LogInfo:    2,
+	LogWarning: 3,
+	LogSevere:  4,
+	LogOff:     5,
+}
+
+//Return the level of the entry as a LogLevel.
+//Java logging levels used by some drivers (FINE, FINER, FINEST, CONFIG) are reported as LogDebug.
+func (e LogEntry) LogLevel() LogLevel {
+	level := LogLevel(strings.ToUpper(e.Level))
+	switch level {
+	case "FINE", "FINER", "FINEST", "CONFIG":
+		return LogDebug
+	}
+	return level
+}
+
+//Return the entries with a level equal or more severe than min.
+//Entries with an unknown level are always returned.
+func FilterLog(entries []LogEntry, min LogLevel) []LogEntry {
+	var filtered []LogEntry
+	for _, e := range entries {
+		rank, found := logLevelRank[e.LogLevel()]
+		if !found || rank >= logLevelRank[min] {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+//Get the browser console log.
+func (s Session) ConsoleLogs() ([]LogEntry, error) {
+	return s.Log("browser")
+}
+
+//Get the performance log (it must be enabled with the logging preferences capability).
+func (s Session) PerformanceLogs() ([]LogEntry, error) {
+	return s.Log("performance")
+}
+
+//Poll the log of the given type every interval and send the new entries on the returned channel until ctx is done.
+//Entries already sent are skipped by timestamp, so it works both with drivers that return only the entries added since
+//the last request and with drivers that return the whole log every time.
+//The stream ends at the first error, that is sent on the error channel. Both channels are closed when the stream ends.
+func (s Session) StreamLog(ctx context.Context, logType string, interval time.Duration) (<-chan LogEntry, <-chan error) {
+	entries := make(chan LogEntry)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(entries)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		//entries with the most recent timestamp already sent, a newer entry may have the same timestamp
+		last := -1
+		var lastEntries []LogEntry
+		for {
+			log, err := s.Log(logType)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			for _, e := range log {
+				if e.TimeStamp < last || e.TimeStamp == last && containsEntry(lastEntries, e) {
+					continue
+				}
+				if e.TimeStamp > last {
+					last, lastEntries = e.TimeStamp, nil
+				}
+				lastEntries = append(lastEntries, e)
+				select {
+				case entries <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return entries, errs
+}
+
+func containsEntry(entries []LogEntry, entry LogEntry) bool {
+	for _, e := range entries {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogEntryLogLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"SEVERE":  LogSevere,
+		"warning": LogWarning,
+		"INFO":    LogInfo,
+		"FINE":    LogDebug,
+		"CONFIG":  LogDebug,
+		"DEBUG":   LogDebug,
+		"ALL":     LogAll,
+	}
+	for level, expected := range tests {
+		if l := (LogEntry{Level: level}).LogLevel(); l != expected {
+			t.Errorf("LogLevel of %q = %q, want %q", level, l, expected)
+		}
+	}
+}
+
+func TestFilterLog(t *testing.T) {
+	entries := []LogEntry{
+		{1, "DEBUG", "debug"},
+		{2, "INFO", "info"},
+		{3, "WARNING", "warning"},
+		{4, "SEVERE", "severe"},
+	}
+	filtered := FilterLog(entries, LogWarning)
+	if len(filtered) != 2 || filtered[0].Message != "warning" || filtered[1].Message != "severe" {
+		t.Fatalf("unexpected entries: %v", filtered)
+	}
+	if len(FilterLog(entries, LogAll)) != 4 {
+		t.Fatal("LogAll must not filter entries")
+	}
+}
+
+func TestConsoleLogs(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		return []LogEntry{{1, "SEVERE", "Uncaught ReferenceError"}}
+	})
+	entries, err := s.ConsoleLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].LogLevel() != LogSevere {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if r := (*requests)[0]; r.Path != "/session/mock/log" || r.Body != `{"type":"browser"}` {
+		t.Fatalf("unexpected request: %s %s", r.Path, r.Body)
+	}
+	if _, err = s.PerformanceLogs(); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[1]; r.Body != `{"type":"performance"}` {
+		t.Fatalf("unexpected request: %s %s", r.Path, r.Body)
+	}
+}
+
+func TestStreamLog(t *testing.T) {
+	batches := [][]LogEntry{
+		{{1, "INFO", "a"}},
+		{{1, "INFO", "a"}, {2, "INFO", "b"}},
+		{{1, "INFO", "a"}, {2, "INFO", "b"}},
+		{{1, "INFO", "a"}, {2, "INFO", "b"}, {2, "INFO", "c"}, {3, "SEVERE", "d"}},
+	}
+	polls := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		batch := batches[len(batches)-1]
+		if polls < len(batches) {
+			batch = batches[polls]
+		}
+		polls++
+		return batch
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, errs := s.StreamLog(ctx, "browser", 10*time.Millisecond)
+	var received []LogEntry
+	for e := range entries {
+		received = append(received, e)
+		if len(received) == 4 {
+			cancel()
+		}
+	}
+	expected := []LogEntry{{1, "INFO", "a"}, {2, "INFO", "b"}, {2, "INFO", "c"}, {3, "SEVERE", "d"}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("unexpected entries: %v", received)
+	}
+	if err, ok := <-errs; ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamLogError(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return mockError{404, 0, map[string]string{"error": "unknown command", "message": "no log"}}
+	})
+	entries, errs := s.StreamLog(context.Background(), "browser", 10*time.Millisecond)
+	if err := <-errs; !isStatus(err, UnknownCommand) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := <-entries; ok {
+		t.Fatal("entries channel should be closed")
+	}
+}
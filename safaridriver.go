@@ -0,0 +1,115 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+//Hint added to the errors of SafariDriver.Start.
+const safariEnableHint = " (safaridriver must be enabled once running \"safaridriver --enable\")"
+
+//A driver for Safari on macOS using /usr/bin/safaridriver. Safaridriver speaks the W3C WebDriver protocol only.
+//
+//Remote automation must be enabled once by running (it requires an administrator password):
+//	safaridriver --enable
+type SafariDriver struct {
+	WebDriverCore
+	//The port that safaridriver listens on. Default: 4445
+	Port int
+	// Log file to dump safaridriver stdout/stderr. If "" send to terminal. Default: ""
+	LogFile string
+	// Start method fails if safaridriver doesn't start in less than StartTimeout. Default 20s.
+	StartTimeout time.Duration
+
+	path    string
+	cmd     *exec.Cmd
+	logFile *os.File
+}
+
+func NewSafariDriver() *SafariDriver {
+	d := &SafariDriver{}
+	d.path = "/usr/bin/safaridriver"
+	d.Port = 4445
+	d.StartTimeout = 20 * time.Second
+	return d
+}
+
+func (d *SafariDriver) Start() error {
+	ssferr := "safaridriver start failed: "
+	if d.cmd != nil {
+		return errors.New(ssferr + "safaridriver already running")
+	}
+	d.url = fmt.Sprintf("http://127.0.0.1:%d", d.Port)
+	cmd := exec.Command(d.path, "--port", strconv.Itoa(d.Port))
+	var stderr *tailBuffer
+	var err error
+	d.logFile, stderr, err = runBrowser(cmd, d.LogFile)
+	if err != nil {
+		return errors.New(ssferr + err.Error() + safariEnableHint)
+	}
+	d.cmd = cmd
+	var exitErr error
+	exited := watchProcess(cmd, &exitErr)
+	if err = probePort(context.Background(), fmt.Sprintf("127.0.0.1:%d", d.Port), d.StartTimeout, exited); err != nil {
+		if err != errProcessExited {
+			//the driver is still running but doesn't listen on the port, don't leave it behind
+			d.cmd.Process.Kill()
+			<-exited
+		}
+		d.cmd = nil
+		if d.logFile != nil {
+			d.logFile.Close()
+			d.logFile = nil
+		}
+		if err == errProcessExited {
+			return startError(ssferr+exitMessage(exitErr)+safariEnableHint, stderr)
+		}
+		return startError(ssferr+err.Error()+safariEnableHint, stderr)
+	}
+	return nil
+}
+
+func (d *SafariDriver) Stop() error {
+	if d.cmd == nil {
+		//never started or already stopped
+		return nil
+	}
+	defer func() {
+		d.cmd = nil
+	}()
+	d.cmd.Process.Signal(os.Interrupt)
+	if d.logFile != nil {
+		d.logFile.Close()
+	}
+	return nil
+}
+
+func (d *SafariDriver) NewSession(desired, required Capabilities) (*Session, error) {
+	session, err := d.newW3CSession(desired, required)
+	if err != nil {
+		return nil, err
+	}
+	session.wd = d
+	return session, nil
+}
+
+func (d *SafariDriver) Sessions() ([]Session, error) {
+	sessions, err := d.sessions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].wd = d
+		sessions[i].W3C = true
+	}
+	return sessions, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafariStartStop(t *testing.T) {
+	if *target != "safari" {
+		t.Skip("requires -target=safari")
+	}
+	d := NewSafariDriver()
+	d.Port = 4446
+	if *wdpath != "" {
+		d.path = *wdpath
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Status(); err != nil {
+		t.Error(err)
+	}
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSafariStartError(t *testing.T) {
+	d := NewSafariDriver()
+	d.path = exitingDriver(t, "safaridriver", "Could not start safaridriver: remote automation is disabled", 1)
+	d.Port = freePort(t)
+	err := d.Start()
+	if err == nil {
+		d.Stop()
+		t.Fatal("Start should fail")
+	}
+	if !strings.Contains(err.Error(), "remote automation is disabled") {
+		t.Fatalf("stderr not reported: %v", err)
+	}
+}
+
+func TestSafariStartTimeout(t *testing.T) {
+	d := NewSafariDriver()
+	d.path = hangingDriver(t, "safaridriver")
+	d.Port = freePort(t)
+	d.StartTimeout = 200 * time.Millisecond
+	for i := 0; i < 2; i++ {
+		err := d.Start()
+		if err == nil {
+			d.Stop()
+			t.Fatal("Start should fail")
+		}
+		if !strings.HasPrefix(err.Error(), "safaridriver start failed: ") || strings.Contains(err.Error(), "already running") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d.cmd != nil || d.logFile != nil {
+			t.Fatal("driver left running")
+		}
+	}
+}
+
+func TestSafariNewSession(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		body = string(buf)
+		writeMockResponse(w, 200, 0, map[string]interface{}{
+			"sessionId":    "w3c",
+			"capabilities": map[string]interface{}{"browserName": "safari"},
+		})
+	}))
+	defer server.Close()
+	d := NewSafariDriver()
+	d.url = server.URL
+	s, err := d.NewSession(Capabilities{"browserName": "safari"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"capabilities":{"alwaysMatch":{},"firstMatch":[{"browserName":"safari"}]}}`
+	if body != expected {
+		t.Fatalf("unexpected request: %s", body)
+	}
+	if s.Id != "w3c" || !s.W3C || s.Capabilities["browserName"] != "safari" {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package webdriver
+
+import (
+	"context"
+	"log/slog"
+)
+
+//Log every command sent to the remote end as a debug record of logger, nil disables logging.
+func (w *WebDriverCore) SetSlogLogger(logger *slog.Logger) {
+	if logger == nil {
+		w.SetCommandLogger(nil)
+		return
+	}
+	w.SetCommandLogger(slogCommandLogger{logger})
+}
+
+type slogCommandLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogCommandLogger) LogCommand(r CommandRecord) {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("url", r.Url),
+		slog.Int("status", r.StatusCode),
+		slog.Duration("duration", r.Duration),
+		slog.String("session", r.SessionId),
+	}
+	if r.Err != nil {
+		attrs = append(attrs, slog.String("error", r.Err.Error()))
+	}
+	if r.RequestBody != "" {
+		attrs = append(attrs, slog.String("request", r.RequestBody))
+	}
+	if r.ResponseBody != "" {
+		attrs = append(attrs, slog.String("response", r.ResponseBody))
+	}
+	l.logger.LogAttrs(context.Background(), slog.LevelDebug, "webdriver command", attrs...)
+}
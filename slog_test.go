@@ -0,0 +1,75 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package webdriver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//a slog.Handler that keeps the records in memory.
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func TestSlogLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMockResponse(w, http.StatusOK, 0, map[string]interface{}{"ready": true})
+	}))
+	defer server.Close()
+	h := &recordHandler{}
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.SetSlogLogger(slog.New(h))
+	if _, err := d.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(h.records))
+	}
+	r := h.records[0]
+	if r.Level != slog.LevelDebug {
+		t.Fatalf("unexpected level: %v", r.Level)
+	}
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	if attrs["method"].String() != "GET" {
+		t.Fatalf("unexpected method: %v", attrs["method"])
+	}
+	if !strings.HasSuffix(attrs["url"].String(), "/status") {
+		t.Fatalf("unexpected url: %v", attrs["url"])
+	}
+	if attrs["status"].Int64() != 200 {
+		t.Fatalf("unexpected status: %v", attrs["status"])
+	}
+	if _, ok := attrs["duration"]; !ok {
+		t.Fatal("missing duration")
+	}
+	if attrs["session"].String() != "mock" {
+		t.Fatalf("unexpected session: %v", attrs["session"])
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 Federico Sogaro. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//A command sent to the remote end, as reported to a CommandLogger.
+type CommandRecord struct {
+	Method string
+	Url    string
+	//HTTP status code of the response, 0 if no response has been received.
+	StatusCode int
+	Duration   time.Duration
+	SessionId  string
+	//Error returned by the command, if any.
+	Err error
+	//JSON bodies of the request and of the response, formatted according to PrettyDebug and DebugBodyLimit.
+	//Empty when there is no body (e.g. GET requests and raw PNG screenshots).
+	RequestBody, ResponseBody string
+}
+
+//Receive a record for every command sent to the remote end (see SetCommandLogger).
+type CommandLogger interface {
+	LogCommand(record CommandRecord)
+}
+
+//Report every command sent to the remote end to logger, nil disables logging.
+func (w *WebDriverCore) SetCommandLogger(logger CommandLogger) {
+	w.logger = logger
+}
+
+//report a command to OnCommand and to the command logger.
+func (w WebDriverCore) logCommand(method, url string, statusCode int, sessionId string, start time.Time, request, response []byte, err error) {
+	duration := time.Since(start)
+	if w.OnCommand != nil {
+		w.OnCommand(method, url, statusCode, duration, err)
+	}
+	if w.logger == nil {
+		return
+	}
+	if sessionId == "" {
+		sessionId = sessionIdFromUrl(url)
+	}
+	w.logger.LogCommand(CommandRecord{method, url, statusCode, duration, sessionId, err,
+		w.formatBody(request), w.formatBody(response)})
+}
+
+//format a JSON body for the command logger, on a single line and truncated to 1024 bytes
+//by default, indented and complete if PrettyDebug is set.
+func (w WebDriverCore) formatBody(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if w.PrettyDebug {
+		err := json.Indent(&buf, body, "", "  ")
+		if err == nil {
+			body = buf.Bytes()
+		}
+	}
+	limit := w.DebugBodyLimit
+	if limit == 0 && !w.PrettyDebug {
+		limit = 1024
+	}
+	if limit > 0 && len(body) > limit {
+		return fmt.Sprintf("%s ...%d more bytes", body[:limit], len(body)-limit)
+	}
+	return string(body)
+}
+
+//return the id in urls like http://host/session/:sessionId/...
+func sessionIdFromUrl(url string) string {
+	i := strings.Index(url, "/session/")
+	if i < 0 {
+		return ""
+	}
+	id := url[i+len("/session/"):]
+	if j := strings.Index(id, "/"); j >= 0 {
+		id = id[:j]
+	}
+	return id
+}
@@ -5,10 +5,19 @@
 package webdriver
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,9 +35,11 @@ func debugprint(message interface{}) {
 	}
 }
 
-//probe d.Port until get a reply or timeout is up
-func probePort(port int, timeout time.Duration) error {
-	address := fmt.Sprintf("127.0.0.1:%d", port)
+//returned by probePort when the process exits before opening the port.
+var errProcessExited = errors.New("process exited")
+
+//probe address (host:port) until get a reply, timeout is up, ctx is done (ctx.Err() is returned) or exited is closed (a nil channel is never closed)
+func probePort(ctx context.Context, address string, timeout time.Duration, exited <-chan struct{}) error {
 	now := time.Now()
 	for {
 		if conn, err := net.Dial("tcp", address); err == nil {
@@ -40,7 +51,205 @@ func probePort(port int, timeout time.Duration) error {
 		if time.Since(now) > timeout {
 			return errors.New("start failed: timeout expired")
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-exited:
+			return errProcessExited
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 	return nil
 }
+
+//wait for the started cmd in background: the returned channel is closed when the process exits, after *exitErr is set to the result of Wait.
+func watchProcess(cmd *exec.Cmd, exitErr *error) <-chan struct{} {
+	exited := make(chan struct{})
+	go func() {
+		*exitErr = cmd.Wait()
+		close(exited)
+	}()
+	return exited
+}
+
+//describe how a process exited, err is the result of Wait.
+func exitMessage(err error) string {
+	if err == nil {
+		return "process exited with status 0"
+	}
+	return "process exited: " + err.Error()
+}
+
+//return a port on 127.0.0.1 that is currently free, chosen by the operating system.
+func freeLocalPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+//return a free port on 127.0.0.1 locked by a file in the temporary directory until release is called,
+//so that drivers started in parallel (also by other processes) don't choose the same port before listening on it.
+//Lock files older than timeout are left by processes that didn't release them and are ignored.
+func lockFreePort(timeout time.Duration) (port int, release func(), err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		port, err = freeLocalPort()
+		if err != nil {
+			return 0, nil, err
+		}
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("webdriver-port-%d.lock", port))
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > timeout {
+			os.Remove(path)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			file.Close()
+			return port, func() { os.Remove(path) }, nil
+		}
+		if time.Now().After(deadline) {
+			return 0, nil, errors.New("timeout expired trying to lock a free port")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+//run "path --version" and return the first word of the output that starts with a digit,
+//e.g. "120.0.6099.109" from "ChromeDriver 120.0.6099.109 (3419140ab665...)".
+func executableVersion(path string) (string, error) {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return "", errors.New("version: " + err.Error())
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if field[0] >= '0' && field[0] <= '9' {
+			return field, nil
+		}
+	}
+	return "", errors.New("version: no version in " + strconv.Quote(strings.TrimSpace(string(out))))
+}
+
+//create a command that runs path with args. The variables in env are added to the environment of the current process.
+func newCommand(path string, args []string, env map[string]string) *exec.Cmd {
+	cmd := exec.Command(path, args...)
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+env[k])
+		}
+	}
+	return cmd
+}
+
+//size of the end of stderr kept by runBrowser to explain start failures.
+const stderrTailSize = 4096
+
+//keeps the last bytes written to it.
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.size {
+		b.buf = append([]byte(nil), b.buf[len(b.buf)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+//return an error with message followed by the end of the stderr of the process, if any.
+func startError(message string, stderr *tailBuffer) error {
+	if tail := strings.TrimSpace(stderr.String()); tail != "" {
+		message += "\nstderr:\n" + tail
+	}
+	return errors.New(message)
+}
+
+//start cmd sending its stdout and stderr to logFile or, if logFile is "", to the stdout and stderr of the program.
+//The end of stderr is also kept in the returned buffer, to be reported if the process fails to start.
+//The returned file (nil if logFile is "") has to be closed once the process is stopped.
+func runBrowser(cmd *exec.Cmd, logFile string) (*os.File, *tailBuffer, error) {
+	var file *os.File
+	if logFile != "" {
+		var err error
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		file, err = os.OpenFile(logFile, flags, 0640)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	tail := &tailBuffer{size: stderrTailSize}
+	if file != nil {
+		cmd.Stdout = file
+		cmd.Stderr = io.MultiWriter(file, tail)
+	} else {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	}
+	if err := cmd.Start(); err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, nil, err
+	}
+	return file, tail, nil
+}
+
+//return the path of the executable name found in PATH or, if missing, the first of locations that exists.
+func findExecutable(name string, locations []string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	for _, path := range locations {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", errors.New(name + " not found in PATH nor in " + strings.Join(locations, ", "))
+}
+
+//host is an IP address or a valid host name.
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
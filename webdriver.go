@@ -6,10 +6,19 @@ package webdriver
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	//	"fmt"
 	//	"net/http"
@@ -18,7 +27,8 @@ import (
 type WebDriver interface {
 	//Start webdriver service
 	Start() error
-	//Stop webdriver service
+	//Stop webdriver service. Stopping a service that is not running does nothing and returns nil,
+	//so Stop can be deferred even if the service is also stopped explicitly.
 	Stop() error
 	//Query the server's status.
 	Status() (*Status, error)
@@ -28,6 +38,21 @@ type WebDriver interface {
 	Sessions() ([]Session, error)
 
 	do(params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error)
+	doContext(ctx context.Context, params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error)
+}
+
+//Start the driver and create a new session that owns it: Session.Close deletes the session and stops the driver.
+func StartSession(wd WebDriver, desired, required Capabilities) (*Session, error) {
+	if err := wd.Start(); err != nil {
+		return nil, err
+	}
+	session, err := wd.NewSession(desired, required)
+	if err != nil {
+		wd.Stop()
+		return nil, err
+	}
+	session.ownsDriver = true
+	return session, nil
 }
 
 //typing saver
@@ -37,6 +62,10 @@ type params map[string]interface{}
 type Status struct {
 	Build Build
 	OS    OS
+	//The server can create new sessions. JSON Wire Protocol servers don't report it and are considered ready when they reply.
+	Ready bool
+	//Message describing the server's status (W3C only).
+	Message string
 }
 
 //Server built details.
@@ -60,7 +89,23 @@ type Capabilities map[string]interface{}
 type Session struct {
 	Id           string
 	Capabilities Capabilities
-	wd           WebDriver
+	//The remote end speaks the W3C WebDriver protocol instead of the JSON Wire Protocol.
+	//It is detected from the response to the new session command and used to choose the endpoints of the commands that differ.
+	W3C bool
+	wd  WebDriver
+	//If not zero, FindElement retries until the element is found or DefaultFindTimeout expires, instead of relying on the implicit wait timeout of the server (see FindElementWait).
+	//FindElements is not affected.
+	DefaultFindTimeout time.Duration
+	//the driver has been started by StartSession and is stopped by Close
+	ownsDriver bool
+	//capabilities as sent by the remote end, see RawCapabilities
+	rawCapabilities []byte
+}
+
+//Return the capabilities of the session exactly as sent by the remote end in response to the new session command.
+//Unlike Capabilities it keeps the order of the keys and the JSON types of the values.
+func (s Session) RawCapabilities() []byte {
+	return s.rawCapabilities
 }
 
 type WindowHandle struct {
@@ -73,11 +118,38 @@ type Size struct {
 	Height int
 }
 
+//Decode a size sent with numbers or with numeric strings.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var v struct{ Width, Height jsonInt }
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Size{int(v.Width), int(v.Height)}
+	return nil
+}
+
 type Position struct {
 	X int
 	Y int
 }
 
+//Decode a position sent with numbers or with numeric strings.
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var v struct{ X, Y jsonInt }
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Position{int(v.X), int(v.Y)}
+	return nil
+}
+
+type Rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
 type FindElementStrategy string
 
 const (
@@ -99,15 +171,61 @@ const (
 	XPath = FindElementStrategy("xpath")
 )
 
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[FindElementStrategy]bool{
+		ClassName: true, CSS_Selector: true, ID: true, Name: true,
+		LinkText: true, PartialLinkText: true, TagName: true, XPath: true,
+	}
+)
+
+//Allow a strategy that is not one of the predefined ones (e.g. an experimental or vendor specific strategy such as "-android uiautomator").
+//Unknown strategies are rejected by the find commands without contacting the server.
+func RegisterFindElementStrategy(using FindElementStrategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[using] = true
+}
+
+func checkStrategy(using FindElementStrategy) error {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	if !strategies[using] {
+		return errors.New("unknown find element strategy: \"" + string(using) + "\" (see RegisterFindElementStrategy)")
+	}
+	return nil
+}
+
+//key used by the W3C protocol to identify a web element in JSON objects.
+const webElementIdentifier = "element-6066-11e4-a52e-4f735466cecf"
+
 type element struct {
 	ELEMENT string
 }
 
+//Decode an element reference sent either with the legacy "ELEMENT" key or with the W3C web element identifier.
+func (e *element) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	e.ELEMENT = m["ELEMENT"]
+	if e.ELEMENT == "" {
+		e.ELEMENT = m[webElementIdentifier]
+	}
+	return nil
+}
+
 type WebElement struct {
 	s  *Session
 	id string
 }
 
+//Encode the element as a WebElement JSON object so that it can be passed as an argument to ExecuteScript, FocusOnFrame, etc.
+func (e WebElement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"ELEMENT": e.id, webElementIdentifier: e.id})
+}
+
 type Cookie struct {
 	Name   string
 	Value  string
@@ -170,6 +288,95 @@ func (s Session) Delete() error {
 	return err
 }
 
+//Delete the session. Quit is an alias of Delete, named after the equivalent Selenium command; the driver is left running.
+func (s Session) Quit() error {
+	return s.Delete()
+}
+
+//Delete the session and, if the session has been created by StartSession, stop the driver.
+//The driver is stopped even if the session can't be deleted, the first error is returned.
+func (s Session) Close() error {
+	err := s.Delete()
+	if s.ownsDriver {
+		if stopErr := s.wd.Stop(); err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+//Send a cheap command (GetUrl) every interval to keep the session alive during long pauses, e.g. on grids that reap idle sessions.
+//The session is serialized (see Serialize), so that the heartbeat doesn't overlap with the commands sent through s
+//and through the copies of s and the elements obtained after the call.
+//Call the returned function to stop the heartbeat; it waits for a running command to complete and can be called more than once.
+func (s *Session) StartHeartbeat(interval time.Duration) (stop func()) {
+	s.Serialize()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.GetUrl()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+//Send a command that is not wrapped by the package (e.g. a driver specific extension) and return the raw JSON value of the response.
+//pathSuffix is relative to the session, e.g. "/goog/cdp/execute"; its segments are escaped, so it can't change the query or leave the session.
+func (s Session) Raw(method, pathSuffix string, body interface{}) ([]byte, error) {
+	segments := strings.Split(strings.TrimPrefix(pathSuffix, "/"), "/")
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			return nil, errors.New("invalid path: " + pathSuffix)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	path := strings.Join(segments, "/")
+	if path != "" {
+		path = "/" + path
+	}
+	_, data, err := s.wd.do(body, method, "/session/%s%s", s.Id, path)
+	return data, err
+}
+
+//Serialize the commands sent through this session (and through the copies of the session and the elements obtained after the call).
+//The WebDriver protocol doesn't support concurrent commands on a session, so goroutines sharing a session must not send commands at the same time: after Serialize they wait for each other.
+func (s *Session) Serialize() {
+	if _, ok := s.wd.(*serialDriver); !ok {
+		s.wd = &serialDriver{WebDriver: s.wd}
+	}
+}
+
+//a driver that sends one command at a time.
+type serialDriver struct {
+	WebDriver
+	mu sync.Mutex
+}
+
+func (d *serialDriver) do(params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.WebDriver.do(params, method, urlFormat, urlParams...)
+}
+
+func (d *serialDriver) doContext(ctx context.Context, params interface{}, method, urlFormat string, urlParams ...interface{}) (string, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.WebDriver.doContext(ctx, params, method, urlFormat, urlParams...)
+}
+
 //Configure the amount of time that a particular type of operation can execute for before they are aborted and a |Timeout| error is returned to the client.  Valid values are: "script" for script timeouts, "implicit" for modifying the implicit wait timeout and "page load" for setting a page load timeout.
 func (s Session) SetTimeouts(typ string, ms int) error {
 	p := params{"type": typ, "ms": ms}
@@ -192,13 +399,66 @@ func (s Session) SetTimeoutsImplicitWait(ms int) error {
 	return err
 }
 
+//Timeouts of the session in milliseconds, as returned by GetTimeouts.
+type Timeouts struct {
+	Implicit int `json:"implicit"`
+	PageLoad int `json:"pageLoad"`
+	//nil if scripts never time out
+	Script *int `json:"script"`
+}
+
+//Get the timeouts of the session (W3C protocol only).
+func (s Session) GetTimeouts() (Timeouts, error) {
+	_, data, err := s.wd.do(nil, "GET", "/session/%s/timeouts", s.Id)
+	if err != nil {
+		return Timeouts{}, err
+	}
+	var timeouts Timeouts
+	err = json.Unmarshal(data, &timeouts)
+	return timeouts, err
+}
+
+func (s Session) setImplicitWait(ms int) error {
+	if !s.W3C {
+		return s.SetTimeoutsImplicitWait(ms)
+	}
+	_, _, err := s.wd.do(params{"implicit": ms}, "POST", "/session/%s/timeouts", s.Id)
+	return err
+}
+
+//Set the implicit wait timeout to d while f runs, then restore the previous value, also if f fails or panics.
+//Legacy drivers can't report the timeouts, in which case the default value 0 is restored.
+//The error of f is returned, or the error restoring the timeout if f succeeded.
+func (s Session) WithImplicitWait(d time.Duration, f func() error) (err error) {
+	previous := 0
+	timeouts, err := s.GetTimeouts()
+	if err == nil {
+		previous = timeouts.Implicit
+	} else if !isUnknownCommand(err) {
+		return err
+	}
+	if err = s.setImplicitWait(int(d / time.Millisecond)); err != nil {
+		return err
+	}
+	defer func() {
+		if restoreErr := s.setImplicitWait(previous); err == nil {
+			err = restoreErr
+		}
+	}()
+	return f()
+}
+
 func (s Session) GetCurrentWindowHandle() WindowHandle {
 	return WindowHandle{&s, "current"}
 }
 
 //Retrieve the current window handle.
 func (s Session) WindowHandle() (WindowHandle, error) {
-	_, data, err := s.wd.do(nil, "GET", "/session/%s/window_handle", s.Id)
+	endpoint := "/session/%s/window_handle"
+	if s.W3C {
+		endpoint = "/session/%s/window"
+	}
+	_, data, err := s.wd.do(nil, "GET", endpoint, s.Id)
 	if err != nil {
 		return WindowHandle{}, err
 	}
@@ -209,7 +469,11 @@ func (s Session) WindowHandle() (WindowHandle, error) {
 
 //Retrieve the list of all window handles available to the session.
 func (s Session) WindowHandles() ([]WindowHandle, error) {
-	_, data, err := s.wd.do(nil, "GET", "/session/%s/window_handles", s.Id)
+	endpoint := "/session/%s/window_handles"
+	if s.W3C {
+		endpoint = "/session/%s/window/handles"
+	}
+	_, data, err := s.wd.do(nil, "GET", endpoint, s.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +534,85 @@ func (s Session) ExecuteScript(script string, args []interface{}) ([]byte, error
 	return data, err
 }
 
+//A JavaScript exception thrown by a script executed with ExecuteScriptChecked.
+type ScriptError struct {
+	//The exception converted to a string, e.g. "TypeError: x is undefined".
+	Message string
+	//The stack trace of the exception, if available.
+	Stack string
+}
+
+func (e *ScriptError) Error() string {
+	if e.Stack == "" {
+		return "javascript error: " + e.Message
+	}
+	return "javascript error: " + e.Message + "\n" + e.Stack
+}
+
+//wraps the user script to catch its exceptions (the script is the body of a function, so it can use return and arguments)
+const (
+	checkedScriptPrefix = `try {
+	return {ok: true, value: (function() {
+`
+	checkedScriptSuffix = `
+	}).apply(this, arguments)};
+} catch (e) {
+	return {ok: false, error: String(e), stack: e && e.stack ? String(e.stack) : ""};
+}`
+)
+
+//Like ExecuteScript, but the exceptions thrown by the script are returned as a *ScriptError with their message and stack trace,
+//instead of the generic JavaScriptError of the driver.
+func (s Session) ExecuteScriptChecked(script string, args []interface{}) ([]byte, error) {
+	data, err := s.ExecuteScript(checkedScriptPrefix+script+checkedScriptSuffix, args)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Ok    bool
+		Value json.RawMessage
+		Error string
+		Stack string
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if !result.Ok {
+		return nil, &ScriptError{result.Error, result.Stack}
+	}
+	//undefined is not returned
+	if result.Value == nil {
+		return []byte("null"), nil
+	}
+	return result.Value, nil
+}
+
+//Wait until there are no jQuery AJAX requests in progress (jQuery.active is 0) or timeout expires.
+//It only helps with sites that use jQuery for AJAX, pages without jQuery are considered idle.
+func (s Session) WaitForAjaxIdle(timeout time.Duration) error {
+	return waitForValue("wait for ajax idle: active requests", "0", timeout, func() (string, error) {
+		data, err := s.ExecuteScript("return window.jQuery ? jQuery.active : 0;", []interface{}{})
+		return string(bytes.TrimSpace(data)), err
+	})
+}
+
+//Wait until document.readyState is state ("loading", "interactive" or "complete", "" means "complete") or timeout expires.
+//It can be used after a navigation to wait for the resources loaded by the page.
+func (s Session) WaitForReadyState(state string, timeout time.Duration) error {
+	if state == "" {
+		state = "complete"
+	}
+	return waitForValue("wait for ready state", state, timeout, func() (string, error) {
+		data, err := s.ExecuteScript("return document.readyState;", []interface{}{})
+		if err != nil {
+			return "", err
+		}
+		var readyState string
+		err = json.Unmarshal(data, &readyState)
+		return readyState, err
+	})
+}
+
 // Inject a snippet of JavaScript into the page for execution in the context of the currently selected frame. The executed script is assumed to be asynchronous and must signal that is done by invoking the provided callback, which is always provided as the final argument to the function. The value to this callback will be returned to the client.
 // Asynchronous script commands may not span page loads. If an unload event is fired while waiting for a script result, an error should be returned to the client.
 // The script argument defines the script to execute in teh form of a function body. The function will be invoked with the provided args array and the values may be accessed via the arguments object in the order specified. The final argument will always be a callback function that must be invoked to signal that the script has finished.
@@ -280,17 +623,116 @@ func (s Session) ExecuteScriptAsync(script string, args []interface{}) ([]byte,
 	return data, err
 }
 
+//Like ExecuteScriptAsync, but the request is aborted when ctx is done, regardless of the async script timeout of the session.
+//The script may still be running in the browser after the request is aborted.
+func (s Session) ExecuteScriptAsyncCtx(ctx context.Context, script string, args []interface{}) ([]byte, error) {
+	p := params{"script": script, "args": args}
+	_, data, err := s.wd.doContext(ctx, p, "POST", "/session/%s/execute_async", s.Id)
+	return data, err
+}
+
 //Take a screenshot of the current page.
+//The PNG image is returned as it is if the server sends it raw (see WebDriverCore.PNGScreenshots), otherwise it is decoded from base64.
 func (s Session) Screenshot() ([]byte, error) {
 	_, data, err := s.wd.do(nil, "GET", "/session/%s/screenshot", s.Id)
 	if err != nil {
 		return nil, err
 	}
-	reader := bytes.NewBuffer(data[1 : len(data)-1])
-	decoder := base64.NewDecoder(base64.StdEncoding, reader)
-	return ioutil.ReadAll(decoder)
+	return decodeScreenshot(data)
+}
+
+//Take a screenshot of the current page and decode it, e.g. to crop it or compare pixels.
+func (s Session) ScreenshotImage() (image.Image, error) {
+	data, err := s.Screenshot()
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+//Take a screenshot of the current page as an *image.RGBA, whatever the color model of the PNG sent by the driver,
+//so that screenshots can be compared pixel by pixel.
+func (s Session) ScreenshotRGBA() (*image.RGBA, error) {
+	img, err := s.ScreenshotImage()
+	if err != nil {
+		return nil, err
+	}
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba, nil
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	return rgba, nil
+}
+
+//decode a screenshot sent as a raw PNG or as a base64 JSON string.
+func decodeScreenshot(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		return data, nil
+	}
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+//Returned by FullPageScreenshot together with a screenshot of the viewport when the browser can't take a screenshot of the entire page.
+var ErrFullPageUnsupported = errors.New("full page screenshot not supported, only the viewport has been captured")
+
+//Take a screenshot of the entire page, not only of the visible part (PNG).
+//It uses the DevTools protocol on chrome (and chromium based browsers driven by chromedriver) and the full page screenshot endpoint of geckodriver on firefox.
+//Other browsers fall back to Screenshot with a warning: the screenshot of the viewport is returned with ErrFullPageUnsupported.
+func (s Session) FullPageScreenshot() ([]byte, error) {
+	switch {
+	case s.isChromium():
+		data, err := s.ExecuteCDP("Page.getLayoutMetrics", nil)
+		if err != nil {
+			return nil, err
+		}
+		var metrics struct {
+			ContentSize    struct{ Width, Height float64 }
+			CssContentSize *struct{ Width, Height float64 }
+		}
+		if err = json.Unmarshal(data, &metrics); err != nil {
+			return nil, err
+		}
+		size := metrics.ContentSize
+		if metrics.CssContentSize != nil {
+			size = *metrics.CssContentSize
+		}
+		clip := map[string]interface{}{"x": 0, "y": 0, "width": size.Width, "height": size.Height, "scale": 1}
+		data, err = s.ExecuteCDP("Page.captureScreenshot", map[string]interface{}{
+			"format":                "png",
+			"captureBeyondViewport": true,
+			"clip":                  clip,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var screenshot struct{ Data string }
+		if err = json.Unmarshal(data, &screenshot); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(screenshot.Data)
+	case s.browserName() == "firefox":
+		_, data, err := s.wd.do(nil, "GET", "/session/%s/moz/screenshot/full", s.Id)
+		if err != nil {
+			return nil, err
+		}
+		return decodeScreenshot(data)
+	}
+	buf, err := s.Screenshot()
+	if err != nil {
+		return nil, err
+	}
+	return buf, ErrFullPageUnsupported
 }
 
+//first bytes of a PNG image.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
 //List all available engines on the machine.
 func (s Session) IMEAvailableEngines() ([]string, error) {
 	_, data, err := s.wd.do(nil, "GET", "session/%s/ime/available_engines", s.Id)
@@ -353,19 +795,119 @@ func (s Session) FocusOnFrame(frameId interface{}) error {
 	return err
 }
 
+//Return the name of each frame of the current document (or its id if it has no name, or an empty string if it has neither), in the order used to focus them by index.
+func (s Session) FrameNames() ([]string, error) {
+	script := `var names = [], frames = document.querySelectorAll("frame, iframe");
+for (var i = 0; i < frames.length; i++) {
+	names.push(frames[i].name || frames[i].id || "");
+}
+return names;`
+	data, err := s.ExecuteScript(script, []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	err = json.Unmarshal(data, &names)
+	return names, err
+}
+
+//Change focus to the frame with the given name or id (see FrameNames).
+//If there is no such frame the error lists the frames of the document.
+func (s Session) SwitchToFrameByName(name string) error {
+	names, err := s.FrameNames()
+	if err != nil {
+		return err
+	}
+	for i, n := range names {
+		if n == name {
+			return s.FocusOnFrame(i)
+		}
+	}
+	return errors.New("no frame named " + strconv.Quote(name) + ", frames: [" + strings.Join(names, ", ") + "]")
+}
+
 // Change focus back to parent frame
 func (s Session) FocusParentFrame() error {
 	_, _, err := s.wd.do(nil, "POST", "/session/%s/frame/parent", s.Id)
 	return err
 }
 
+//Change focus to the given frame while f runs, then back to the parent frame, also if f fails or panics.
+//A string frame is looked up with SwitchToFrameByName, an int by index and a WebElement by reference.
+//Calls can be nested. The error of f is returned, or the error focusing the parent frame if f succeeded.
+func (s Session) WithinFrame(frame interface{}, f func() error) (err error) {
+	if name, ok := frame.(string); ok {
+		err = s.SwitchToFrameByName(name)
+	} else {
+		err = s.FocusOnFrame(frame)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if parentErr := s.FocusParentFrame(); err == nil {
+			err = parentErr
+		}
+	}()
+	return f()
+}
+
 //Change focus to another window. The window to change focus to may be specified by its server assigned window handle, or by the value of its name attribute.
 func (s Session) FocusOnWindow(name string) error {
 	p := params{"name": name}
+	if s.W3C {
+		p = params{"handle": name}
+	}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/window", s.Id)
 	return err
 }
 
+//Change focus to the most recently opened window, e.g. after clicking a link with target="_blank".
+//The newest window is the last one returned by WindowHandles other than the current one; an error is returned if there is no other window.
+func (s Session) SwitchToNewestWindow() error {
+	current, err := s.WindowHandle()
+	if err != nil {
+		return err
+	}
+	handles, err := s.WindowHandles()
+	if err != nil {
+		return err
+	}
+	for i := len(handles) - 1; i >= 0; i-- {
+		if handles[i].id != current.id {
+			return s.FocusOnWindow(handles[i].id)
+		}
+	}
+	return errors.New("switch to newest window: no new window")
+}
+
+//Close the current window (e.g. a popup) and change focus to the window identified by handle (e.g. the opener, saved with WindowHandle before switching to the popup).
+//Nothing is closed if handle doesn't identify another open window.
+func (s Session) CloseAndSwitchTo(handle string) error {
+	current, err := s.WindowHandle()
+	if err != nil {
+		return err
+	}
+	if current.id == handle {
+		return errors.New("close and switch: " + handle + " is the current window")
+	}
+	handles, err := s.WindowHandles()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, h := range handles {
+		found = found || h.id == handle
+	}
+	if !found {
+		return errors.New("close and switch: no such window: " + handle)
+	}
+	if err = s.CloseCurrentWindow(); err != nil {
+		return err
+	}
+	return s.FocusOnWindow(handle)
+}
+
 //Close the current window.
 func (s Session) CloseCurrentWindow() error {
 	_, _, err := s.wd.do(nil, "DELETE", "/session/%s/window", s.Id)
@@ -376,12 +918,19 @@ func (s Session) CloseCurrentWindow() error {
 func (w WindowHandle) SetSize(size Size) error {
 	p := params{"width": size.Width, "height": size.Height}
 	_, _, err := w.s.wd.do(p, "POST", "/session/%s/window/%s/size", w.s.Id, w.id)
+	if isUnknownCommand(err) {
+		return w.setRect(p)
+	}
 	return err
 }
 
 //Get the size of the specified window.
 func (w WindowHandle) GetSize() (Size, error) {
 	_, data, err := w.s.wd.do(nil, "GET", "/session/%s/window/%s/size", w.s.Id, w.id)
+	if isUnknownCommand(err) {
+		rect, err := w.rect()
+		return Size{rect.Width, rect.Height}, err
+	}
 	if err != nil {
 		return Size{}, err
 	}
@@ -394,12 +943,19 @@ func (w WindowHandle) GetSize() (Size, error) {
 func (w WindowHandle) SetPosition(position Position) error {
 	p := params{"x": position.X, "y": position.Y}
 	_, _, err := w.s.wd.do(p, "POST", "/session/%s/window/%s/position", w.s.Id, w.id)
+	if isUnknownCommand(err) {
+		return w.setRect(p)
+	}
 	return err
 }
 
 //Get the position of the specified window.
 func (w WindowHandle) GetPosition() (Position, error) {
 	_, data, err := w.s.wd.do(nil, "GET", "/session/%s/window/%s/position", w.s.Id, w.id)
+	if isUnknownCommand(err) {
+		rect, err := w.rect()
+		return Position{rect.X, rect.Y}, err
+	}
 	if err != nil {
 		return Position{}, err
 	}
@@ -408,6 +964,22 @@ func (w WindowHandle) GetPosition() (Position, error) {
 	return position, err
 }
 
+//W3C drivers don't support the per window size and position commands, but only the rect of the current window.
+func (w WindowHandle) rect() (Rect, error) {
+	_, data, err := w.s.wd.do(nil, "GET", "/session/%s/window/rect", w.s.Id)
+	if err != nil {
+		return Rect{}, err
+	}
+	var rect Rect
+	err = json.Unmarshal(data, &rect)
+	return rect, err
+}
+
+func (w WindowHandle) setRect(p params) error {
+	_, _, err := w.s.wd.do(p, "POST", "/session/%s/window/rect", w.s.Id)
+	return err
+}
+
 //Maximize the specified window if not already maximized.
 func (w WindowHandle) MaximizeWindow() error {
 	_, _, err := w.s.wd.do(nil, "POST", "/session/%s/window/%s/maximize", w.s.Id, w.id)
@@ -425,6 +997,29 @@ func (s Session) GetCookies() ([]Cookie, error) {
 	return cookies, err
 }
 
+//Retrieve all cookies visible to the current page, keyed by name.
+func (s Session) GetCookiesMap() (map[string]Cookie, error) {
+	cookies, err := s.GetCookies()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]Cookie, len(cookies))
+	for _, cookie := range cookies {
+		m[cookie.Name] = cookie
+	}
+	return m, nil
+}
+
+//Retrieve the value of the cookie with the given name and whether it is visible to the current page.
+func (s Session) CookieValue(name string) (string, bool, error) {
+	cookies, err := s.GetCookiesMap()
+	if err != nil {
+		return "", false, err
+	}
+	cookie, found := cookies[name]
+	return cookie.Value, found, nil
+}
+
 //Set a cookie.
 func (s Session) SetCookie(cookie Cookie) error {
 	p := params{"cookie": cookie}
@@ -444,6 +1039,54 @@ func (s Session) DeleteCookieByName(name string) error {
 	return err
 }
 
+//Cookies matched by DeleteCookieMatching that have not been deleted.
+type CookieDeleteError struct {
+	//Cookies sharing their name with a cookie that didn't match.
+	Cookies []Cookie
+}
+
+func (e *CookieDeleteError) Error() string {
+	cookies := make([]string, len(e.Cookies))
+	for i, c := range e.Cookies {
+		cookies[i] = c.Name + " (domain " + c.Domain + ", path " + c.Path + ")"
+	}
+	return "delete cookies: not uniquely deletable by name: " + strings.Join(cookies, ", ")
+}
+
+//Delete the cookies visible to the current page for which predicate returns true, e.g. to select them by path or domain.
+//The protocol deletes cookies by name only, so deleting a cookie also deletes the cookies with the same name for other paths and domains:
+//matching cookies that share their name with a cookie that doesn't match are left alone and reported by a *CookieDeleteError.
+func (s Session) DeleteCookieMatching(predicate func(Cookie) bool) error {
+	cookies, err := s.GetCookies()
+	if err != nil {
+		return err
+	}
+	shared := map[string]bool{}
+	for _, c := range cookies {
+		if !predicate(c) {
+			shared[c.Name] = true
+		}
+	}
+	deleted := map[string]bool{}
+	var skipped []Cookie
+	for _, c := range cookies {
+		switch {
+		case !predicate(c) || deleted[c.Name]:
+		case shared[c.Name]:
+			skipped = append(skipped, c)
+		default:
+			if err := s.DeleteCookieByName(c.Name); err != nil {
+				return err
+			}
+			deleted[c.Name] = true
+		}
+	}
+	if len(skipped) > 0 {
+		return &CookieDeleteError{Cookies: skipped}
+	}
+	return nil
+}
+
 //Get the current page source.
 func (s Session) Source() (string, error) {
 	_, data, err := s.wd.do(nil, "GET", "/session/%s/source", s.Id)
@@ -466,12 +1109,31 @@ func (s Session) Title() (string, error) {
 	return title, err
 }
 
+//Get the URL and the title of the current page, e.g. to describe the page in a failure report.
+//They are read with two separate commands, so they may belong to different pages if a navigation happens in between.
+func (s Session) PageInfo() (url, title string, err error) {
+	if url, err = s.GetUrl(); err != nil {
+		return "", "", err
+	}
+	if title, err = s.Title(); err != nil {
+		return "", "", err
+	}
+	return url, title, nil
+}
+
 func (s Session) WebElementFromId(id string) WebElement {
 	return WebElement{&s, id}
 }
 
 //Search for an element on the page, starting from the document root.
 func (s Session) FindElement(using FindElementStrategy, value string) (WebElement, error) {
+	return s.FindElementWait(using, value, s.DefaultFindTimeout)
+}
+
+func (s Session) findElement(using FindElementStrategy, value string) (WebElement, error) {
+	if err := checkStrategy(using); err != nil {
+		return WebElement{}, err
+	}
 	p := params{"using": using, "value": value}
 	_, data, err := s.wd.do(p, "POST", "/session/%s/element", s.Id)
 	if err != nil {
@@ -482,8 +1144,48 @@ func (s Session) FindElement(using FindElementStrategy, value string) (WebElemen
 	return WebElement{&s, elem.ELEMENT}, err
 }
 
+//Search for an element on the page, starting from the document root, retrying until it appears or timeout expires.
+//It doesn't depend on the implicit wait timeout and overrides DefaultFindTimeout: a zero timeout searches once. On timeout the error of the last attempt is returned.
+func (s Session) FindElementWait(using FindElementStrategy, value string, timeout time.Duration) (WebElement, error) {
+	return pollElement(func() (WebElement, error) { return s.findElement(using, value) }, timeout, false)
+}
+
+//Like FindElementWait, but also wait for the element to be displayed.
+func (s Session) FindElementVisibleWait(using FindElementStrategy, value string, timeout time.Duration) (WebElement, error) {
+	return pollElement(func() (WebElement, error) { return s.findElement(using, value) }, timeout, true)
+}
+
+var errElementNotDisplayed = errors.New("element is not displayed")
+
+//call find until it finds an element (displayed if visible is true) or timeout expires.
+func pollElement(find func() (WebElement, error), timeout time.Duration, visible bool) (WebElement, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		we, err := find()
+		if err == nil && visible {
+			var displayed bool
+			displayed, err = we.IsDisplayed()
+			if err == nil && !displayed {
+				err = errElementNotDisplayed
+			}
+		}
+		if err == nil {
+			return we, nil
+		}
+		//the element may be replaced between FindElement and IsDisplayed
+		retry := isStatus(err, NoSuchElement) || isStatus(err, StaleElementReference) || err == errElementNotDisplayed
+		if !retry || time.Now().After(deadline) {
+			return WebElement{}, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 //Search for multiple elements on the page, starting from the document root.
 func (s Session) FindElements(using FindElementStrategy, value string) ([]WebElement, error) {
+	if err := checkStrategy(using); err != nil {
+		return nil, err
+	}
 	p := params{"using": using, "value": value}
 	_, data, err := s.wd.do(p, "POST", "/session/%s/elements", s.Id)
 	if err != nil {
@@ -501,9 +1203,39 @@ func (s Session) FindElements(using FindElementStrategy, value string) ([]WebEle
 	return elements, err
 }
 
+//Find elements and return their visible text (see Text), e.g. to collect the labels of the rows of a list.
+//If an element goes stale while the texts are read (e.g. because the list is re-rendered) the elements are found again, up to 3 times.
+func (s Session) FindElementsText(using FindElementStrategy, value string) ([]string, error) {
+	for attempt := 1; ; attempt++ {
+		texts, err := s.findElementsText(using, value)
+		if err == nil || attempt == 3 || !isStatus(err, StaleElementReference) {
+			return texts, err
+		}
+	}
+}
+
+func (s Session) findElementsText(using FindElementStrategy, value string) ([]string, error) {
+	elements, err := s.FindElements(using, value)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(elements))
+	for i, e := range elements {
+		if texts[i], err = e.Text(); err != nil {
+			return nil, err
+		}
+	}
+	return texts, nil
+}
+
 //Get the element on the page that currently has focus.
 func (s Session) GetActiveElement() (WebElement, error) {
-	_, data, err := s.wd.do(nil, "POST", "/session/%s/element/active", s.Id)
+	//the JSON Wire Protocol uses POST, W3C changed it to GET
+	method := "POST"
+	if s.W3C {
+		method = "GET"
+	}
+	_, data, err := s.wd.do(nil, method, "/session/%s/element/active", s.Id)
 	if err != nil {
 		return WebElement{}, err
 	}
@@ -518,7 +1250,20 @@ func (s Session) GetActiveElement() (WebElement, error) {
 }*/
 
 //Search for an element on the page, starting from the identified element.
+//The search is retried up to the DefaultFindTimeout of the session.
 func (e WebElement) FindElement(using FindElementStrategy, value string) (WebElement, error) {
+	return e.FindElementWait(using, value, e.s.DefaultFindTimeout)
+}
+
+//Like Session.FindElementWait, starting from the identified element.
+func (e WebElement) FindElementWait(using FindElementStrategy, value string, timeout time.Duration) (WebElement, error) {
+	return pollElement(func() (WebElement, error) { return e.findElement(using, value) }, timeout, false)
+}
+
+func (e WebElement) findElement(using FindElementStrategy, value string) (WebElement, error) {
+	if err := checkStrategy(using); err != nil {
+		return WebElement{}, err
+	}
 	p := params{"using": using, "value": value}
 	_, data, err := e.s.wd.do(p, "POST", "/session/%s/element/%s/element", e.s.Id, e.id)
 	if err != nil {
@@ -531,6 +1276,9 @@ func (e WebElement) FindElement(using FindElementStrategy, value string) (WebEle
 
 //Search for multiple elements on the page, starting from the identified element.
 func (e WebElement) FindElements(using FindElementStrategy, value string) ([]WebElement, error) {
+	if err := checkStrategy(using); err != nil {
+		return nil, err
+	}
 	p := params{"using": using, "value": value}
 	_, data, err := e.s.wd.do(p, "POST", "/session/%s/element/%s/elements", e.s.Id, e.id)
 	if err != nil {
@@ -548,18 +1296,175 @@ func (e WebElement) FindElements(using FindElementStrategy, value string) ([]Web
 	return elements, err
 }
 
+//Get all the attributes of the element with one command, e.g. to describe it in a failure report.
+//Values are the ones in the HTML source (like GetAttributeOK), not the current properties.
+func (e WebElement) Attributes() (map[string]string, error) {
+	script := `var attributes = {}, list = arguments[0].attributes;
+for (var i = 0; i < list.length; i++) {
+	attributes[list[i].name] = list[i].value;
+}
+return attributes;`
+	data, err := e.s.ExecuteScript(script, []interface{}{e})
+	if err != nil {
+		return nil, err
+	}
+	var attributes map[string]string
+	err = json.Unmarshal(data, &attributes)
+	return attributes, err
+}
+
+//Get the child elements of the element, an empty slice if it has none. Text nodes are skipped.
+func (e WebElement) Children() ([]WebElement, error) {
+	data, err := e.s.ExecuteScript("return Array.prototype.slice.call(arguments[0].children);", []interface{}{e})
+	if err != nil {
+		return nil, err
+	}
+	var v []element
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	elements := make([]WebElement, len(v))
+	for i, z := range v {
+		elements[i] = WebElement{e.s, z.ELEMENT}
+	}
+	return elements, nil
+}
+
+//Get the element that follows the element in its parent, found is false if it is the last one. Text nodes are skipped.
+func (e WebElement) NextSibling() (sibling WebElement, found bool, err error) {
+	return e.scriptElement("return arguments[0].nextElementSibling;")
+}
+
+//Get the element that precedes the element in its parent, found is false if it is the first one. Text nodes are skipped.
+func (e WebElement) PreviousSibling() (sibling WebElement, found bool, err error) {
+	return e.scriptElement("return arguments[0].previousElementSibling;")
+}
+
+//run a script that returns an element or null, the element is passed as the first argument.
+func (e WebElement) scriptElement(script string) (WebElement, bool, error) {
+	data, err := e.s.ExecuteScript(script, []interface{}{e})
+	if err != nil {
+		return WebElement{}, false, err
+	}
+	var v element
+	if err = json.Unmarshal(data, &v); err != nil {
+		return WebElement{}, false, err
+	}
+	if v.ELEMENT == "" {
+		return WebElement{}, false, nil
+	}
+	return WebElement{e.s, v.ELEMENT}, true, nil
+}
+
 //Click on an element.
 func (e WebElement) Click() error {
 	_, _, err := e.s.wd.do(nil, "POST", "/session/%s/element/%s/click", e.s.Id, e.id)
 	return err
 }
 
+//Click on an element. If the click is intercepted by another element that overlays the target, scroll the element into view and try to click once more.
+//The error of the first click is returned if the second click fails too.
+func (e WebElement) ClickSafely() error {
+	err := e.Click()
+	if err == nil || !isClickIntercepted(err) {
+		return err
+	}
+	if e.ScrollIntoView(false) != nil || e.Click() != nil {
+		return err
+	}
+	return nil
+}
+
+var errElementNotEnabled = errors.New("element is not enabled")
+
+//Wait until the element is displayed and enabled, then click on it.
+//If the click is intercepted by another element or the element is reported stale (e.g. while the page is re-rendered), it is clicked once more.
+func (e WebElement) ClickWhenClickable(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := e.checkClickable()
+		if err == nil {
+			break
+		}
+		if (err != errElementNotDisplayed && err != errElementNotEnabled) || time.Now().After(deadline) {
+			return errors.New("click when clickable: " + err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	err := e.Click()
+	if err != nil && (isClickIntercepted(err) || isStatus(err, StaleElementReference)) {
+		time.Sleep(100 * time.Millisecond)
+		err = e.Click()
+	}
+	return err
+}
+
+func (e WebElement) checkClickable() error {
+	displayed, err := e.IsDisplayed()
+	if err != nil {
+		return err
+	}
+	if !displayed {
+		return errElementNotDisplayed
+	}
+	enabled, err := e.IsEnabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errElementNotEnabled
+	}
+	return nil
+}
+
+//the W3C protocol has a dedicated error code, with the JSON Wire Protocol chromedriver reports an unknown error with a message.
+func isClickIntercepted(err error) bool {
+	cerr, ok := err.(*CommandError)
+	if !ok {
+		return false
+	}
+	return cerr.Code == "element click intercepted" ||
+		strings.Contains(cerr.Message, "element click intercepted") ||
+		strings.Contains(cerr.Message, "is not clickable at point")
+}
+
 //Submit a FORM element.
 func (e WebElement) Submit() error {
 	_, _, err := e.s.wd.do(nil, "POST", "/session/%s/element/%s/submit", e.s.Id, e.id)
 	return err
 }
 
+//Submit a FORM element and wait up to timeout for the resulting navigation.
+//The navigation is detected by the <html> element of the current document going stale, also when the form is submitted to the same url,
+//so changes of the old page while it is submitted (e.g. a spinner) don't end the wait; then the new document has to be loaded completely.
+func (e WebElement) SubmitAndWait(timeout time.Duration) error {
+	root, err := e.s.FindElement(TagName, "html")
+	if err != nil {
+		return err
+	}
+	if err = e.Submit(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	unloaded := false
+	for {
+		//errors are expected while the page is loading
+		if !unloaded {
+			_, err := root.Name()
+			unloaded = isStatus(err, StaleElementReference) || isStatus(err, NoSuchElement)
+		}
+		if unloaded {
+			if state, err := e.s.ExecuteScript("return document.readyState;", []interface{}{}); err == nil && string(state) == `"complete"` {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return errors.New("submit: navigation not completed in " + timeout.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 //Returns the visible text for the element.
 func (e WebElement) Text() (string, error) {
 	_, data, err := e.s.wd.do(nil, "GET", "/session/%s/element/%s/text", e.s.Id, e.id)
@@ -571,24 +1476,46 @@ func (e WebElement) Text() (string, error) {
 	return text, err
 }
 
+//Returns the visible text for the element with leading and trailing white space removed.
+func (e WebElement) TextTrimmed() (string, error) {
+	text, err := e.Text()
+	return strings.TrimSpace(text), err
+}
+
+//Returns the visible text for the element with leading and trailing white space removed and internal runs of white space collapsed to a single space.
+func (e WebElement) TextCollapsed() (string, error) {
+	text, err := e.Text()
+	return collapseSpaces(text), err
+}
+
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
 //Send a sequence of key strokes to an element.
 func (e WebElement) SendKeys(sequence string) error {
-	keys := make([]string, len(sequence))
-	for i, k := range sequence {
-		keys[i] = string(k)
-	}
-	p := params{"value": keys}
+	p := params{"value": splitKeys(sequence)}
 	_, _, err := e.s.wd.do(p, "POST", "/session/%s/element/%s/value", e.s.Id, e.id)
 	return err
 }
 
+//Send a sequence of key strokes to an element one character at a time, waiting perKeyDelay between them.
+//This works around inputs that drop characters typed too fast, at the cost of one command (and one delay) per character.
+func (e WebElement) SendKeysSlowly(sequence string, perKeyDelay time.Duration) error {
+	for i, k := range splitKeys(sequence) {
+		if i > 0 {
+			time.Sleep(perKeyDelay)
+		}
+		if err := e.SendKeys(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //Send a sequence of key strokes to the active element.
 func (s Session) SendKeysOnActiveElement(sequence string) error {
-	keys := make([]string, len(sequence))
-	for i, k := range sequence {
-		keys[i] = string(k)
-	}
-	p := params{"value": keys}
+	p := params{"value": splitKeys(sequence)}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/keys", s.Id)
 	return err
 }
@@ -610,9 +1537,34 @@ func (e WebElement) Clear() error {
 	return err
 }
 
+//Replace the content of a TEXTAREA or text INPUT element with text.
+//If Clear fails or leaves some text in the element (e.g. on widgets that restore their content), the content is selected with Ctrl+A and deleted before typing text.
+//The fallback doesn't work where select all is bound to another key (e.g. Command+A on macOS).
+func (e WebElement) SetText(text string) error {
+	err := e.Clear()
+	if err == nil {
+		var value string
+		value, err = e.Value()
+		if err == nil && value != "" {
+			err = errors.New("element not cleared")
+		}
+	}
+	if err != nil {
+		if err = e.SendKeys(Chord(KeyControl, "a") + KeyDelete); err != nil {
+			return err
+		}
+	}
+	return e.SendKeys(text)
+}
+
 //Determine if an OPTION element, or an INPUT element of type checkbox or radiobutton is currently selected.
 func (e WebElement) IsSelected() (bool, error) {
-	_, data, err := e.s.wd.do(nil, "GET", "/session/%s/element/%s/value", e.s.Id, e.id)
+	//legacy drivers answer on /value, W3C defines /selected
+	endpoint := "/session/%s/element/%s/value"
+	if e.s.W3C {
+		endpoint = "/session/%s/element/%s/selected"
+	}
+	_, data, err := e.s.wd.do(nil, "GET", endpoint, e.s.Id, e.id)
 	if err != nil {
 		return false, err
 	}
@@ -633,15 +1585,70 @@ func (e WebElement) IsEnabled() (bool, error) {
 }
 
 //Get the value of an element's attribute.
+//An absent attribute is returned as an empty string, use GetAttributeOK to tell it from an empty value.
 func (e WebElement) GetAttribute(name string) (string, error) {
+	attribute, _, err := e.GetAttributeOK(name)
+	return attribute, err
+}
+
+//Get the value of an element's attribute and whether the element has the attribute.
+//This distinguishes an absent attribute from an empty one, e.g. for boolean attributes like "disabled".
+func (e WebElement) GetAttributeOK(name string) (value string, present bool, err error) {
 	_, data, err := e.s.wd.do(nil, "GET", "/session/%s/element/%s/attribute/%s", e.s.Id, e.id, name)
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	return decodeAttribute(data)
+}
+
+//the server sends null for an absent attribute.
+func decodeAttribute(data []byte) (string, bool, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return "", false, nil
 	}
 	var attribute string
-	err = json.Unmarshal(data, &attribute)
-	return attribute, err
-	//return z, e.do("GET", u, nil, &z)
+	err := json.Unmarshal(data, &attribute)
+	return attribute, err == nil, err
+}
+
+//Get the current value of an element's DOM property as JSON.
+//Unlike attributes, that reflect the HTML source, properties reflect the live state of the element.
+//On drivers that don't support the W3C property endpoint the property is read with a script.
+func (e WebElement) GetProperty(name string) ([]byte, error) {
+	if !e.s.W3C {
+		return e.s.ExecuteScript("return arguments[0][arguments[1]];", []interface{}{e, name})
+	}
+	_, data, err := e.s.wd.do(nil, "GET", "/session/%s/element/%s/property/%s", e.s.Id, e.id, name)
+	return data, err
+}
+
+//Get the current value of an INPUT, TEXTAREA or SELECT element, including the text typed by the user.
+//GetAttribute("value") returns instead the value attribute, that is the default value set in the HTML source.
+func (e WebElement) Value() (string, error) {
+	return e.stringProperty("value")
+}
+
+//Get the innerText property of the element: the text as rendered, but also for elements that are not displayed, for which it is the same as TextContent.
+//Text instead returns an empty string for elements that are not displayed.
+func (e WebElement) InnerText() (string, error) {
+	return e.stringProperty("innerText")
+}
+
+//Get the textContent property of the element: the text of all the nodes it contains, including hidden elements and scripts, with the white space of the source.
+//Unlike Text it doesn't depend on the element being displayed.
+func (e WebElement) TextContent() (string, error) {
+	return e.stringProperty("textContent")
+}
+
+func (e WebElement) stringProperty(name string) (string, error) {
+	data, err := e.GetProperty(name)
+	if err != nil {
+		return "", err
+	}
+	var value string
+	err = json.Unmarshal(data, &value)
+	return value, err
 }
 
 //Test if two element IDs refer to the same DOM element.
@@ -702,6 +1709,49 @@ func (e WebElement) Size() (Size, error) {
 	return size, err
 }
 
+//Determine an element's location on the page and its size in pixels.
+func (e WebElement) GetRect() (Rect, error) {
+	position, err := e.GetLocation()
+	if err != nil {
+		return Rect{}, err
+	}
+	size, err := e.Size()
+	if err != nil {
+		return Rect{}, err
+	}
+	return Rect{position.X, position.Y, size.Width, size.Height}, nil
+}
+
+//Determine the location of the top-left corner of the element relative to the viewport (the visible part of the page), rounded to whole pixels.
+//Unlike GetLocation it changes when the page is scrolled, and it is negative for elements above or to the left of the viewport.
+func (e WebElement) ViewportLocation() (Position, error) {
+	script := "var r = arguments[0].getBoundingClientRect(); return {X: Math.round(r.left), Y: Math.round(r.top)};"
+	data, err := e.s.ExecuteScript(script, []interface{}{e})
+	if err != nil {
+		return Position{}, err
+	}
+	var position Position
+	err = json.Unmarshal(data, &position)
+	return position, err
+}
+
+//Determine the location of the center of the element on the page, e.g. to target it with pointer actions relative to the viewport or the page.
+func (e WebElement) Center() (Position, error) {
+	rect, err := e.GetRect()
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{rect.X + rect.Width/2, rect.Y + rect.Height/2}, nil
+}
+
+//Scroll the element into the visible area of the browser window.
+//If alignToTop is true the top of the element is aligned to the top of the visible area, otherwise the bottom of the element is aligned to the bottom of the visible area.
+func (e WebElement) ScrollIntoView(alignToTop bool) error {
+	script := "arguments[0].scrollIntoView(arguments[1]); return null;"
+	_, err := e.s.ExecuteScript(script, []interface{}{e, alignToTop})
+	return err
+}
+
 //Query the value of an element's computed CSS property.
 func (e WebElement) GetCssProperty(name string) (string, error) {
 	_, data, err := e.s.wd.do(nil, "GET", "/session/%s/element/%s/css/%s", e.s.Id, e.id, name)
@@ -713,6 +1763,38 @@ func (e WebElement) GetCssProperty(name string) (string, error) {
 	return cssProperty, err
 }
 
+//Wait until the element's attribute has value or timeout expires.
+//Errors while reading the attribute (e.g. a stale element during an animation) don't stop the wait, the last one is reported on timeout.
+func (e WebElement) WaitForAttribute(name, value string, timeout time.Duration) error {
+	return waitForValue("wait for attribute "+name, value, timeout, func() (string, error) {
+		return e.GetAttribute(name)
+	})
+}
+
+//Wait until the element's computed CSS property has value or timeout expires, see WaitForAttribute.
+func (e WebElement) WaitForCSSProperty(name, value string, timeout time.Duration) error {
+	return waitForValue("wait for css property "+name, value, timeout, func() (string, error) {
+		return e.GetCssProperty(name)
+	})
+}
+
+func waitForValue(what, expected string, timeout time.Duration, get func() (string, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		value, err := get()
+		if err == nil && value == expected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return errors.New(what + ": " + err.Error())
+			}
+			return errors.New(what + ": got " + strconv.Quote(value) + ", expected " + strconv.Quote(expected))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 type ScreenOrientation string
 
 const (
@@ -750,6 +1832,19 @@ func (s Session) GetAlertText() (string, error) {
 	return alertText, err
 }
 
+//Wait until an alert(), confirm() or prompt() dialog is displayed, e.g. by a script that opens it asynchronously, and return its text.
+//If no dialog is displayed within timeout the NoAlertOpenError of the last attempt is returned.
+func (s Session) WaitForAlert(timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		text, err := s.GetAlertText()
+		if !isStatus(err, NoAlertOpenError) || time.Now().After(deadline) {
+			return text, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 //Sends keystrokes to a JavaScript prompt() dialog.
 func (s Session) SetAlertText(text string) error {
 	p := params{"text": text}
@@ -777,6 +1872,17 @@ func (s Session) MoveTo(element WebElement, xoffset, yoffset int) error {
 	return err
 }
 
+//Move the mouse to the center of the element.
+//Unlike MoveTo(element, 0, 0), no offset is sent, so the center is used by every driver.
+func (s Session) MoveToElement(element WebElement) error {
+	if s.W3C {
+		return s.PerformActions([]ActionSequence{mouseActions(pointerMove(element, 0, 0, 0))})
+	}
+	p := params{"element": element.id}
+	_, _, err := s.wd.do(p, "POST", "/session/%s/moveto", s.Id)
+	return err
+}
+
 type MouseButton int
 
 const (
@@ -815,6 +1921,8 @@ func (s Session) DoubleClick() error {
 }
 
 //Single tap on the touch enabled device.
+//
+//Deprecated: not supported by W3C drivers, use TapElement.
 func (s Session) TouchClick(element WebElement) error {
 	p := params{"element": element.id}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/click", s.Id)
@@ -822,6 +1930,8 @@ func (s Session) TouchClick(element WebElement) error {
 }
 
 //Finger down on the screen.
+//
+//Deprecated: not supported by W3C drivers, use Swipe or PerformActions.
 func (s Session) TouchDown(x, y int) error {
 	p := params{"x": x, "y": y}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/down", s.Id)
@@ -829,6 +1939,8 @@ func (s Session) TouchDown(x, y int) error {
 }
 
 //Finger up on the screen.
+//
+//Deprecated: not supported by W3C drivers, use Swipe or PerformActions.
 func (s Session) TouchUp(x, y int) error {
 	p := params{"x": x, "y": y}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/up", s.Id)
@@ -836,6 +1948,8 @@ func (s Session) TouchUp(x, y int) error {
 }
 
 //Finger move on the screen.
+//
+//Deprecated: not supported by W3C drivers, use Swipe or PerformActions.
 func (s Session) TouchMove(x, y int) error {
 	p := params{"x": x, "y": y}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/move", s.Id)
@@ -843,6 +1957,8 @@ func (s Session) TouchMove(x, y int) error {
 }
 
 //Scroll on the touch screen using finger based motion events.
+//
+//Deprecated: not supported by W3C drivers, use Swipe.
 func (s Session) TouchScroll(element WebElement, xoffset, yoffset int) error {
 	p := params{"element": element.id, "xoffset": xoffset, "yoffset": yoffset}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/scroll", s.Id)
@@ -850,6 +1966,8 @@ func (s Session) TouchScroll(element WebElement, xoffset, yoffset int) error {
 }
 
 //Double tap on the touch screen using finger motion events.
+//
+//Deprecated: not supported by W3C drivers, use PerformActions.
 func (s Session) TouchDoubleClick(element WebElement) error {
 	p := params{"element": element.id}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/doubleclick", s.Id)
@@ -857,6 +1975,8 @@ func (s Session) TouchDoubleClick(element WebElement) error {
 }
 
 //Long press on the touch screen using finger motion events.
+//
+//Deprecated: not supported by W3C drivers, use LongPress.
 func (s Session) TouchLongClick(element WebElement) error {
 	p := params{"element": element.id}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/longclick", s.Id)
@@ -865,6 +1985,8 @@ func (s Session) TouchLongClick(element WebElement) error {
 
 //Flick on the touch screen using finger motion events.
 //This flickcommand starts at a particulat screen location.
+//
+//Deprecated: not supported by W3C drivers, use Swipe.
 func (s Session) TouchFlick(element WebElement, xoffset, yoffset, speed int) error {
 	p := params{"element": element.id, "xoffset": xoffset, "yoffset": yoffset, "speed": speed}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/flick", s.Id)
@@ -873,6 +1995,8 @@ func (s Session) TouchFlick(element WebElement, xoffset, yoffset, speed int) err
 
 //Flick on the touch screen using finger motion events.
 //Use this flick command if you don't care where the flick starts on the screen.
+//
+//Deprecated: not supported by W3C drivers, use Swipe.
 func (s Session) TouchFlickAnywhere(xspeed, yspeed int) error {
 	p := params{"xspeed": xspeed, "yspeed": yspeed}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/touch/flick", s.Id)
@@ -891,12 +2015,96 @@ func (s Session) GetGeoLocation() (GeoLocation, error) {
 }
 
 //Set the current geo location.
+//Latitude must be in [-90, 90] and longitude in [-180, 180], invalid locations are rejected without contacting the server.
 func (s Session) SetGeoLocation(location GeoLocation) error {
+	if err := location.validate(); err != nil {
+		return err
+	}
 	p := params{"location": location}
 	_, _, err := s.wd.do(p, "POST", "/session/%s/location", s.Id)
 	return err
 }
 
+//Remove the geo location set with SetGeoLocation and restore the one of the device (chrome only).
+func (s Session) ClearGeoLocation() error {
+	if s.browserName() != "chrome" {
+		return errors.New("clear geo location: not supported by " + s.browserName())
+	}
+	_, err := s.ExecuteCDP("Emulation.clearGeolocationOverride", nil)
+	return err
+}
+
+//Emulate a device pixel ratio (e.g. 2 for retina screenshots) without changing the size of the window (chrome only).
+//On firefox set the "layout.css.devPixelsPerPx" preference of the profile to the ratio as a string (e.g. "2.0") instead.
+func (s Session) SetDevicePixelRatio(ratio float64) error {
+	if math.IsNaN(ratio) || math.IsInf(ratio, 0) || ratio <= 0 {
+		return errors.New("invalid device pixel ratio: " + strconv.FormatFloat(ratio, 'g', -1, 64))
+	}
+	if s.browserName() != "chrome" {
+		return errors.New("set device pixel ratio: not supported by " + s.browserName())
+	}
+	//width and height 0 keep the size of the window
+	_, err := s.ExecuteCDP("Emulation.setDeviceMetricsOverride", map[string]interface{}{
+		"width":             0,
+		"height":            0,
+		"deviceScaleFactor": ratio,
+		"mobile":            false,
+	})
+	return err
+}
+
+//Change the User-Agent string sent by the browser and returned by navigator.userAgent in a running session (chrome only).
+//To set it when the browser starts use ChromeOptions.SetUserAgent or FirefoxDriver.SetUserAgent.
+func (s Session) SetUserAgentRuntime(ua string) error {
+	if s.browserName() != "chrome" {
+		return errors.New("set user agent: not supported by " + s.browserName())
+	}
+	_, err := s.ExecuteCDP("Network.setUserAgentOverride", map[string]interface{}{"userAgent": ua})
+	return err
+}
+
+//Evaluate script in every new document before the scripts of the page (chrome only), e.g. to stub Date or Math.random or to install test hooks.
+//The returned identifier can be used to remove the script with RemoveInitScript. The script is not run in the current document.
+func (s Session) AddInitScript(script string) (identifier string, err error) {
+	if s.browserName() != "chrome" {
+		return "", errors.New("add init script: not supported by " + s.browserName())
+	}
+	data, err := s.ExecuteCDP("Page.addScriptToEvaluateOnNewDocument", map[string]interface{}{"source": script})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Identifier string `json:"identifier"`
+	}
+	err = json.Unmarshal(data, &result)
+	return result.Identifier, err
+}
+
+//Stop evaluating the script added with AddInitScript in new documents (chrome only).
+func (s Session) RemoveInitScript(identifier string) error {
+	if s.browserName() != "chrome" {
+		return errors.New("remove init script: not supported by " + s.browserName())
+	}
+	_, err := s.ExecuteCDP("Page.removeScriptToEvaluateOnNewDocument", map[string]interface{}{"identifier": identifier})
+	return err
+}
+
+func (l GeoLocation) validate() error {
+	check := func(name string, value, limit float64) error {
+		if math.IsNaN(value) || value < -limit || value > limit {
+			return errors.New("invalid geo location: " + name + " " + strconv.FormatFloat(value, 'g', -1, 64) + " out of range")
+		}
+		return nil
+	}
+	if err := check("latitude", l.Latitude, 90); err != nil {
+		return err
+	}
+	if err := check("longitude", l.Longitude, 180); err != nil {
+		return err
+	}
+	return check("altitude", l.Altitude, math.MaxFloat64)
+}
+
 //helper functions, storageType can be "local_storage" or "session_storage"
 func (s Session) storageGetKeys(storageType string) ([]string, error) {
 	_, data, err := s.wd.do(nil, "GET", "/session/%s/%s", s.Id, storageType)
@@ -946,6 +2154,48 @@ func (s Session) storageSize(storageType string) (int, error) {
 	return size, err
 }
 
+func (s Session) storageSetJSON(storageType, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.storageSetKey(storageType, key, string(value))
+}
+
+func (s Session) storageGetJSON(storageType, key string, out interface{}) error {
+	value, err := s.storageGetKey(storageType, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), out)
+}
+
+func (s Session) storageSnapshot(storageType string) (map[string]string, error) {
+	keys, err := s.storageGetKeys(storageType)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if items[key], err = s.storageGetKey(storageType, key); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (s Session) storageRestore(storageType string, items map[string]string) error {
+	if err := s.storageClear(storageType); err != nil {
+		return err
+	}
+	for key, value := range items {
+		if err := s.storageSetKey(storageType, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //Get all keys of the storage.
 func (s Session) LocalStorageGetKeys() ([]string, error) {
 	return s.storageGetKeys("local_storage")
@@ -976,6 +2226,26 @@ func (s Session) LocalStorageSize() (int, error) {
 	return s.storageSize("local_storage")
 }
 
+//Set the storage item for the given key to the JSON encoding of v.
+func (s Session) LocalStorageSetJSON(key string, v interface{}) error {
+	return s.storageSetJSON("local_storage", key, v)
+}
+
+//Decode the JSON storage item for the given key into out.
+func (s Session) LocalStorageGetJSON(key string, out interface{}) error {
+	return s.storageGetJSON("local_storage", key, out)
+}
+
+//Get all the items of the storage, e.g. to restore them with LocalStorageRestore at the end of a test.
+func (s Session) LocalStorageSnapshot() (map[string]string, error) {
+	return s.storageSnapshot("local_storage")
+}
+
+//Replace the content of the storage with items.
+func (s Session) LocalStorageRestore(items map[string]string) error {
+	return s.storageRestore("local_storage", items)
+}
+
 //Get all keys of the storage.
 func (s Session) SessionStorageGetKeys() ([]string, error) {
 	return s.storageGetKeys("session_storage")
@@ -1006,6 +2276,48 @@ func (s Session) SessionStorageSize() (int, error) {
 	return s.storageSize("session_storage")
 }
 
+//Set the storage item for the given key to the JSON encoding of v.
+func (s Session) SessionStorageSetJSON(key string, v interface{}) error {
+	return s.storageSetJSON("session_storage", key, v)
+}
+
+//Decode the JSON storage item for the given key into out.
+func (s Session) SessionStorageGetJSON(key string, out interface{}) error {
+	return s.storageGetJSON("session_storage", key, out)
+}
+
+//Get all the items of the storage, e.g. to restore them with SessionStorageRestore at the end of a test.
+func (s Session) SessionStorageSnapshot() (map[string]string, error) {
+	return s.storageSnapshot("session_storage")
+}
+
+//Replace the content of the storage with items.
+func (s Session) SessionStorageRestore(items map[string]string) error {
+	return s.storageRestore("session_storage", items)
+}
+
+//Delete all the cookies visible to the current page, clear its local and session storage and, on chrome, the browser cache, e.g. to isolate tests sharing a session.
+//All the steps are attempted even if some of them fail, the returned error reports all the failures.
+func (s Session) ResetState() error {
+	var failures []string
+	check := func(step string, err error) {
+		if err != nil {
+			failures = append(failures, step+": "+err.Error())
+		}
+	}
+	check("delete cookies", s.DeleteCookies())
+	check("clear local storage", s.LocalStorageClear())
+	check("clear session storage", s.SessionStorageClear())
+	if s.browserName() == "chrome" {
+		_, err := s.ExecuteCDP("Network.clearBrowserCache", nil)
+		check("clear cache", err)
+	}
+	if len(failures) > 0 {
+		return errors.New("reset state: " + strings.Join(failures, "; "))
+	}
+	return nil
+}
+
 //Get the log for a given log type.
 func (s Session) Log(logType string) ([]LogEntry, error) {
 	p := params{"type": logType}
@@ -6,22 +6,35 @@ package webdriver
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"image"
+	"image/color"
 	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 var (
-	target = flag.String("target", "", "target driver (chrome|firefox)")
-	wdpath = flag.String("wdpath", "", "path to chromedriver (chrome) or webdriver.xpi (firefox)")
+	target = flag.String("target", "", "target driver (chrome|firefox|safari|edge)")
+	wdpath = flag.String("wdpath", "", "path to chromedriver (chrome), webdriver.xpi (firefox), msedgedriver (edge) or safaridriver (safari, optional)")
 	wdlog  = flag.String("wdlogdir", "", "dir where to dump log files")
 )
 
@@ -43,12 +56,84 @@ var pages = [][]string{
 	{"elements", `<!DOCTYPE html><html><body><form name="input" action="" method="get">
 <input type="checkbox" name="check1" value="Check1">Check 1<br>
 <input type="checkbox" name="check2" value="Check2">Check 2<br><br>
+<input type="text" name="text1" id="text1" value="default"><br>
 <input type="submit" value="Submit">
 </form> 
 <div id="foo" style="color:#0000FF">
   <h3>This is a heading</h3>
   <p>This is a <a href="http://golang.com">longwordlinktogolang</a> to a page served by a go server.</p>
 </div>
+<div id="hidden" style="display:none">Hidden text</div>
+</body></html>`},
+
+	{"multiline", `<!DOCTYPE html><html><body>
+<pre id="poem">
+   Roses   are red,
+	violets are blue.   
+</pre>
+</body></html>`},
+
+	{"long", `<!DOCTYPE html><html><body>
+<div style="height:5000px">Top</div>
+<div id="bottom">Bottom</div>
+<div style="height:5000px"></div>
+</body></html>`},
+
+	{"mouse", `<!DOCTYPE html><html><body>
+<div id="target" style="width:200px;height:100px"
+	ondblclick="this.setAttribute('data-event', 'dblclick')"
+	oncontextmenu="this.setAttribute('data-event', 'contextmenu'); return false;">Target</div>
+</body></html>`},
+
+	{"hover", `<!DOCTYPE html><html><head><style>
+#menu ul { display: none; }
+#menu:hover ul { display: block; }
+</style></head><body>
+<div id="menu" style="width:200px">Menu<ul><li id="item">Item</li></ul></div>
+</body></html>`},
+
+	{"stubborn", `<!DOCTYPE html><html><head><title>webdriver stubborn</title></head><body>
+<input type="text" id="stubborn" value="default">
+<script>
+var input = document.getElementById("stubborn"), typed = false;
+input.addEventListener("keydown", function() { typed = true; });
+input.addEventListener("change", function() { if (!typed) input.value = "default"; });
+</script>
+</body></html>`},
+
+	{"alert", `<!DOCTYPE html><html><head><title>webdriver alert</title></head><body>
+<script>setTimeout(function() { alert("delayed"); }, 500);</script>
+</body></html>`},
+
+	{"frames", `<!DOCTYPE html><html><head><title>webdriver frames</title></head><body>
+<iframe name="first" src="simple"></iframe>
+<iframe id="second" src="simple2"></iframe>
+</body></html>`},
+
+	{"nested", `<!DOCTYPE html><html><head><title>webdriver nested</title></head><body>
+<iframe name="outer" src="frames"></iframe>
+</body></html>`},
+
+	{"keyup", `<!DOCTYPE html><html><head><title>webdriver keyup</title></head><body>
+<input type="text" id="search" onkeyup="var c = document.getElementById('count'); c.textContent = +c.textContent + 1">
+<div id="count">0</div>
+</body></html>`},
+
+	{"list", `<!DOCTYPE html><html><head><title>webdriver list</title></head><body>
+<ul id="rows"><li>First</li><li>Second</li><li>Third</li></ul>
+</body></html>`},
+
+	{"range", `<!DOCTYPE html><html><head><title>webdriver range</title></head><body>
+<input type="range" id="slider" min="0" max="100" value="50" style="width:200px">
+</body></html>`},
+
+	{"delayed", `<!DOCTYPE html><html><head><title>webdriver delayed</title></head><body>
+<button id="late" disabled onclick="this.textContent = 'clicked'">Late</button>
+<script>setTimeout(function() { document.getElementById("late").disabled = false; }, 500);</script>
+</body></html>`},
+
+	{"windows", `<!DOCTYPE html><html><head><title>webdriver windows</title></head><body>
+<a id="popup" href="simple2" target="_blank">Open</a>
 </body></html>`},
 }
 
@@ -73,17 +158,69 @@ func checkServer(t *testing.T) {
 	go http.Serve(ln, nil)
 }
 
+//a request received by a mock remote end.
+type mockRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+//start a mock remote end that replies to every command with the value returned by reply and return a session connected to it.
+func newMockSession(t *testing.T, reply func(r mockRequest) interface{}) (*Session, *[]mockRequest) {
+	var requests []mockRequest
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := mockRequest{r.Method, r.URL.Path, string(body)}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		var value interface{}
+		if reply != nil {
+			value = reply(req)
+		}
+		if e, ok := value.(mockError); ok {
+			writeMockResponse(w, e.HTTPStatus, e.Status, e.Value)
+			return
+		}
+		writeMockResponse(w, http.StatusOK, 0, value)
+	}))
+	t.Cleanup(server.Close)
+	d := NewChromeDriver("")
+	d.url = server.URL
+	return &Session{Id: "mock", wd: d}, &requests
+}
+
+//returned by a mock reply function to send an error response.
+type mockError struct {
+	HTTPStatus int
+	Status     int
+	Value      interface{}
+}
+
+func writeMockResponse(w http.ResponseWriter, httpStatus, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessionId": "mock", "status": status, "value": value})
+}
+
 func checkWebDriver(t *testing.T) {
 	if wd == nil {
 		switch *target {
 		case "":
 			t.Fatal(`specify a target browser:
 			chrome: go test webdriver -target="chrome" -wdpath="/path/to/chromedriver"
-			firefox: go test webdriver -target="firefox" -wdpath="/path/to/webdriver.xpi"`)
+			firefox: go test webdriver -target="firefox" -wdpath="/path/to/webdriver.xpi"
+			safari: go test webdriver -target="safari"
+			edge: go test webdriver -target="edge" -wdpath="/path/to/msedgedriver"`)
 		case "chrome":
 			wd = startChromedriver(t)
 		case "firefox":
 			wd = startFirefoxdriver(t)
+		case "safari":
+			wd = startSafaridriver(t)
+		case "edge":
+			wd = startEdgedriver(t)
 		default:
 			t.Fatal("Unknown target browser: " + *target)
 		}
@@ -137,6 +274,33 @@ func startFirefoxdriver(t *testing.T) WebDriver {
 	return firefoxdriver
 }
 
+func startSafaridriver(t *testing.T) WebDriver {
+	safaridriver := NewSafariDriver()
+	if *wdpath != "" {
+		safaridriver.path = *wdpath
+	}
+	if *wdlog != "" {
+		safaridriver.LogFile = filepath.Join(*wdlog, "safaridriver.log")
+	}
+	err := safaridriver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return safaridriver
+}
+
+func startEdgedriver(t *testing.T) WebDriver {
+	edgedriver := NewEdgeDriver(*wdpath)
+	if *wdlog != "" {
+		edgedriver.LogPath = filepath.Join(*wdlog, "msedgedriver.log")
+	}
+	err := edgedriver.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edgedriver
+}
+
 func TestStatus(t *testing.T) {
 	checkWebDriver(t)
 	_, err := wd.Status()
@@ -151,7 +315,7 @@ func TestCreateSession(t *testing.T) {
 
 func TestSessions(t *testing.T) {
 	switch *target {
-	case "chrome", "firefox":
+	case "chrome", "firefox", "safari", "edge":
 		t.Skip("Not implemented on", *target)
 	}
 	checkSession(t)
@@ -193,6 +357,130 @@ func TestWindowHandle(t *testing.T) {
 	}
 }
 
+func TestSwitchToNewestWindowMock(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		switch r.Path {
+		case "/session/mock/window_handle":
+			return "main"
+		case "/session/mock/window_handles":
+			return []string{"main", "old", "new"}
+		}
+		return nil
+	})
+	if err := s.SwitchToNewestWindow(); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[2]; r.Path != "/session/mock/window" || r.Body != `{"name":"new"}` {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+}
+
+func TestSwitchToNewestWindow(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("windows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := session.WindowHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := session.FindElement(ID, "popup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = link.Click(); err != nil {
+		t.Fatal(err)
+	}
+	defer session.FocusOnWindow(main.id)
+	//the window may not be listed as soon as the click returns
+	for i := 0; ; i++ {
+		if err = session.SwitchToNewestWindow(); err == nil || i == 20 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseCurrentWindow()
+	var title string
+	for i := 0; i < 20 && title != "webdriver simple 2"; i++ {
+		if title, err = session.Title(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if title != "webdriver simple 2" {
+		t.Fatalf("unexpected title of the new window: %q", title)
+	}
+}
+
+func TestCloseAndSwitchToMissing(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		switch r.Path {
+		case "/session/mock/window_handle":
+			return "popup"
+		case "/session/mock/window_handles":
+			return []string{"popup"}
+		}
+		return nil
+	})
+	if err := s.CloseAndSwitchTo("main"); err == nil {
+		t.Fatal("CloseAndSwitchTo should fail")
+	}
+	for _, r := range *requests {
+		if r.Method == "DELETE" {
+			t.Fatal("the current window should not be closed")
+		}
+	}
+}
+
+func TestCloseAndSwitchTo(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("windows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := session.WindowHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := session.FindElement(ID, "popup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = link.Click(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if err = session.SwitchToNewestWindow(); err == nil || i == 20 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.CloseAndSwitchTo(main.id); err != nil {
+		t.Fatal(err)
+	}
+	title, err := session.Title()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "webdriver windows" {
+		t.Fatalf("unexpected title: %q", title)
+	}
+	handles, err := session.WindowHandles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handles) != 1 {
+		t.Fatalf("expected 1 window, got %d", len(handles))
+	}
+}
+
 func getUrl(page string) string {
 	return "http://" + addr + "/" + page
 }
@@ -257,6 +545,157 @@ func TestUrl(t *testing.T) {
 	}
 }
 
+func TestAttributes(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo, err := session.FindElement(ID, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes, err := foo.Attributes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"id": "foo", "style": "color:#0000FF"}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Fatalf("unexpected attributes: %v", attributes)
+	}
+}
+
+func TestSiblingsMock(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		switch {
+		case strings.Contains(r.Body, "children"):
+			return []map[string]string{{webElementIdentifier: "1"}, {webElementIdentifier: "2"}}
+		case strings.Contains(r.Body, "nextElementSibling"):
+			return map[string]string{webElementIdentifier: "3"}
+		}
+		return nil
+	})
+	e := s.WebElementFromId("0")
+	children, err := e.Children()
+	if err != nil || len(children) != 2 || children[0].id != "1" || children[1].id != "2" {
+		t.Fatalf("unexpected children: %v (%v)", children, err)
+	}
+	if next, found, err := e.NextSibling(); err != nil || !found || next.id != "3" {
+		t.Fatalf("unexpected next sibling: %v, %v (%v)", next, found, err)
+	}
+	if _, found, err := e.PreviousSibling(); err != nil || found {
+		t.Fatalf("unexpected previous sibling: %v (%v)", found, err)
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo, err := session.FindElement(ID, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := foo.Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(children))
+	}
+	tags := func(e WebElement) string {
+		name, err := e.Name()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.ToLower(name)
+	}
+	if tags(children[0]) != "h3" || tags(children[1]) != "p" {
+		t.Fatalf("unexpected children: %s, %s", tags(children[0]), tags(children[1]))
+	}
+	next, found, err := children[0].NextSibling()
+	if err != nil || !found || tags(next) != "p" {
+		t.Fatalf("unexpected next sibling of h3: %v (%v)", found, err)
+	}
+	previous, found, err := children[1].PreviousSibling()
+	if err != nil || !found || tags(previous) != "h3" {
+		t.Fatalf("unexpected previous sibling of p: %v (%v)", found, err)
+	}
+	if _, found, err = children[0].PreviousSibling(); err != nil || found {
+		t.Fatalf("h3 should have no previous sibling: %v (%v)", found, err)
+	}
+	if _, found, err = children[1].NextSibling(); err != nil || found {
+		t.Fatalf("p should have no next sibling: %v (%v)", found, err)
+	}
+	link, err := foo.FindElement(TagName, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children, err = link.Children(); err != nil || children == nil || len(children) != 0 {
+		t.Fatalf("link should have no children: %v (%v)", children, err)
+	}
+}
+
+func TestHiddenText(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden, err := session.FindElement(ID, "hidden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := hidden.Text(); err != nil || text != "" {
+		t.Fatalf("Text of a hidden element should be empty, got %q (%v)", text, err)
+	}
+	if text, err := hidden.TextContent(); err != nil || text != "Hidden text" {
+		t.Fatalf("unexpected text content %q (%v)", text, err)
+	}
+	if text, err := hidden.InnerText(); err != nil || text != "Hidden text" {
+		t.Fatalf("unexpected inner text %q (%v)", text, err)
+	}
+}
+
+func TestAddInitScript(t *testing.T) {
+	checkSession(t)
+	if session.browserName() != "chrome" {
+		t.Skip("init scripts are supported only by chrome")
+	}
+	id, err := session.AddInitScript("window.injected = 42;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.RemoveInitScript(id)
+	if err = session.Url(getUrl("simple")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := session.ExecuteScript("return window.injected;", []interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "42" {
+		t.Fatalf("init script not evaluated: %s", data)
+	}
+}
+
+func TestPageInfo(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, title, err := session.PageInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != getUrl("simple") || title != "webdriver simple" {
+		t.Fatalf("unexpected page info: %q, %q", url, title)
+	}
+}
+
 func TestExecuteScript(t *testing.T) {
 	checkSession(t)
 	value1, value2 := 4, 7
@@ -304,126 +743,2159 @@ func TestExecuteScriptAsyncTimeout(t *testing.T) {
 	}
 }
 
-func TestScreenshot(t *testing.T) {
-	checkSession(t)
-	err := session.Url("http://" + addr + "/simple")
-	if err != nil {
-		t.Fatal(err) //tested already
-	}
-	buf, err := session.Screenshot()
-	if err != nil {
-		t.Fatal(err)
+func TestExecuteScriptAsyncCtx(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		time.Sleep(time.Second)
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := s.ExecuteScriptAsyncCtx(ctx, "", []interface{}{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	_, err = png.Decode(bytes.NewBuffer(buf))
-	if err != nil {
-		t.Fatal("returned data is not a png image: " + err.Error())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("request not aborted, took %v", elapsed)
 	}
 }
 
-func xTestIME(t *testing.T) {
-	checkSession(t)
-	// TODO IMEAvailableEngines
-	// TODO IMEActiveEngine
-	// TODO IsIMEActivated
-	// TODO IMEDeactivate
-	// TODO IMEActivate
-}
-
-func xTestFocusOnFrame(t *testing.T) {
-	checkSession(t)
-	// TODO FocusOnFrame
+func TestWaitForReadyStateMock(t *testing.T) {
+	states := []string{"loading", "interactive", "complete"}
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		return state
+	})
+	if err := s.WaitForReadyState("", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(*requests))
+	}
 }
 
-func TestWindow(t *testing.T) {
+func TestWaitForReadyState(t *testing.T) {
 	checkSession(t)
-	// TODO session.FocusOnWindow
-	// TODO session.CloseCurrentWindow
-	// TODO wh.SetPosition
-	// TODO wh.GetPosition
-	// TODO wh.Maximize
-	wh := session.GetCurrentWindowHandle()
-	size, err := wh.GetSize()
+	err := session.Url(getUrl("simple"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	//t.Logf("width: %d, height: %d", size.Width, size.Height)
-	err = wh.SetSize(Size{size.Width / 2, size.Height / 2})
-	if err != nil {
+	//reopen the document, readyState is "loading" until it is closed
+	script := `document.open();
+	window.setTimeout(function() {
+		document.write('<p id="done">done</p>');
+		document.close();
+	}, 500);`
+	if _, err = session.ExecuteScript(script, []interface{}{}); err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(1 * time.Second)
-	size2, err := wh.GetSize()
-	if err != nil {
+	if err = session.WaitForReadyState("complete", 5*time.Second); err != nil {
 		t.Fatal(err)
 	}
-	//t.Logf("width2: %d, height2: %d", size2.Width, size2.Height)
-	time.Sleep(3 * time.Second)
-	if size2.Width != size.Width/2 || size2.Height != size.Height/2 {
-		t.Log(size2.Width, size.Width/2, size2.Height, size.Height/2)
-		t.Fatal("size got with GetSize different from size set with SetSize")
+	if _, err = session.FindElement(ID, "done"); err != nil {
+		t.Fatal(err)
 	}
-	err = wh.SetSize(Size{size.Width, size.Height})
-	if err != nil {
+}
+
+func TestWaitForAjaxIdleMock(t *testing.T) {
+	active := 3
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		active--
+		return active
+	})
+	if err := s.WaitForAjaxIdle(5 * time.Second); err != nil {
 		t.Fatal(err)
 	}
+	if active != 0 {
+		t.Fatalf("returned with %d active requests", active)
+	}
 }
 
-func xTestCookie(t *testing.T) {
+func TestWaitForAjaxIdle(t *testing.T) {
 	checkSession(t)
-	// TODO GetCookies
-	// TODO SetCookie
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.WaitForAjaxIdle(time.Second); err != nil {
+		t.Fatal("page without jQuery should be idle: " + err.Error())
+	}
+	//simulate two AJAX requests completing one after the other
+	script := `window.jQuery = {active: 2};
+	window.setTimeout(function() { jQuery.active--; }, 300);
+	window.setTimeout(function() { jQuery.active--; }, 600);`
+	if _, err = session.ExecuteScript(script, []interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.WaitForAjaxIdle(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	checkSession(t)
+	err := session.Url("http://" + addr + "/simple")
+	if err != nil {
+		t.Fatal(err) //tested already
+	}
+	buf, err := session.Screenshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = png.Decode(bytes.NewBuffer(buf))
+	if err != nil {
+		t.Fatal("returned data is not a png image: " + err.Error())
+	}
+}
+
+func TestScreenshotImageMock(t *testing.T) {
+	encoded := mockScreenshot(t)
+	s, _ := newMockSession(t, func(r mockRequest) interface{} { return encoded })
+	img, err := s.ScreenshotImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 4 {
+		t.Fatalf("unexpected bounds: %v", img.Bounds())
+	}
+}
+
+func TestScreenshotRGBA(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	gray.SetGray(1, 1, color.Gray{200})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gray); err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	s, _ := newMockSession(t, func(r mockRequest) interface{} { return encoded })
+	rgba, err := s.ScreenshotRGBA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rgba.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("unexpected bounds: %v", rgba.Bounds())
+	}
+	if c := rgba.RGBAAt(1, 1); c != (color.RGBA{200, 200, 200, 255}) {
+		t.Fatalf("unexpected pixel: %v", c)
+	}
+}
+
+func TestScreenshotImage(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := session.ScreenshotImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Empty() {
+		t.Fatal("empty screenshot")
+	}
+}
+
+func TestScreenshotFormats(t *testing.T) {
+	encoded := mockScreenshot(t)
+	raw, _ := base64.StdEncoding.DecodeString(encoded)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Accept"), "image/png") {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(raw)
+			return
+		}
+		writeMockResponse(w, 200, 0, encoded)
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	s := Session{Id: "mock", wd: d}
+	for _, png := range []bool{false, true} {
+		d.PNGScreenshots = png
+		buf, err := s.Screenshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, raw) {
+			t.Fatalf("unexpected screenshot (PNGScreenshots: %v): %q", png, buf)
+		}
+	}
+}
+
+func TestFullPageScreenshotMock(t *testing.T) {
+	encoded := mockScreenshot(t)
+	raw, _ := base64.StdEncoding.DecodeString(encoded)
+	for _, browser := range []string{"chrome", "chrome-headless-shell", "firefox", "safari"} {
+		s, requests := newMockSession(t, func(r mockRequest) interface{} {
+			switch {
+			case strings.Contains(r.Body, "Page.getLayoutMetrics"):
+				return map[string]interface{}{"cssContentSize": map[string]int{"width": 800, "height": 5000}}
+			case strings.Contains(r.Body, "Page.captureScreenshot"):
+				return map[string]string{"data": encoded}
+			}
+			return encoded
+		})
+		s.Capabilities = Capabilities{"browserName": browser}
+		buf, err := s.FullPageScreenshot()
+		if browser == "safari" {
+			if err != ErrFullPageUnsupported {
+				t.Fatalf("fallback not reported: %v", err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, raw) {
+			t.Fatalf("%s: unexpected screenshot: %q", browser, buf)
+		}
+		var paths []string
+		for _, r := range *requests {
+			paths = append(paths, r.Path)
+		}
+		expected := map[string][]string{
+			"chrome":                {"/session/mock/goog/cdp/execute", "/session/mock/goog/cdp/execute"},
+			"chrome-headless-shell": {"/session/mock/goog/cdp/execute", "/session/mock/goog/cdp/execute"},
+			"firefox":               {"/session/mock/moz/screenshot/full"},
+			"safari":                {"/session/mock/screenshot"},
+		}[browser]
+		if !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("%s: unexpected requests: %v", browser, paths)
+		}
+		if strings.HasPrefix(browser, "chrome") && !strings.Contains((*requests)[1].Body, `"height":5000`) {
+			t.Fatalf("unexpected clip: %s", (*requests)[1].Body)
+		}
+	}
+}
+
+func TestFullPageScreenshot(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := session.FullPageScreenshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewBuffer(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := session.ExecuteScript("return window.innerHeight * window.devicePixelRatio", []interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var viewport float64
+	if err = json.Unmarshal(res, &viewport); err != nil {
+		t.Fatal(err)
+	}
+	if float64(img.Bounds().Dy()) <= viewport {
+		t.Fatalf("screenshot height %d not taller than the viewport %v", img.Bounds().Dy(), viewport)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+		writeMockResponse(w, 200, 0, "http://example.com/")
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.CommandTimeout = 100 * time.Millisecond
+	s := Session{Id: "mock", wd: d}
+	start := time.Now()
+	_, err := s.GetUrl()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("command not aborted by CommandTimeout")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeMockResponse(w, 200, 0, map[string]interface{}{"ready": true})
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	if _, err := d.Status(); err == nil {
+		t.Fatal("request without credentials must fail")
+	}
+	d.SetBasicAuth("user", "pass")
+	if _, err := d.Status(); err != nil {
+		t.Fatal(err)
+	}
+	d.SetAuthHeader("Authorization", "Bearer token")
+	if _, err := d.Status(); err == nil {
+		t.Fatal("request with wrong credentials must fail")
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	var buildIds []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildIds = append(buildIds, r.Method+" "+r.Header.Get("X-Build-Id"))
+		writeMockResponse(w, 200, 0, nil)
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.SetHeader("X-Build-Id", "42")
+	s := Session{Id: "mock", wd: d}
+	if _, err := s.GetUrl(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Url("http://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	d.RemoveHeader("X-Build-Id")
+	if _, err := s.GetUrl(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"GET 42", "POST 42", "GET "}
+	if !reflect.DeepEqual(buildIds, expected) {
+		t.Fatalf("unexpected headers: %q", buildIds)
+	}
+}
+
+func TestOnCommand(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Path == "/session/mock/title" {
+			return mockError{500, UnknownError, map[string]string{"message": "boom"}}
+		}
+		return "http://example.com"
+	})
+	type call struct {
+		method, url string
+		status      int
+		dur         time.Duration
+		err         error
+	}
+	var calls []call
+	s.wd.(*ChromeDriver).OnCommand = func(method, url string, status int, dur time.Duration, err error) {
+		calls = append(calls, call{method, url, status, dur, err})
+	}
+	if _, err := s.GetUrl(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Title(); err == nil {
+		t.Fatal("Title should fail")
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	for _, c := range calls {
+		if c.method != "GET" || c.dur <= 0 {
+			t.Fatalf("unexpected call: %+v", c)
+		}
+	}
+	if calls[0].status != 200 || calls[0].err != nil || !strings.HasSuffix(calls[0].url, "/session/mock/url") {
+		t.Fatalf("unexpected call: %+v", calls[0])
+	}
+	if calls[1].status != 500 || calls[1].err == nil {
+		t.Fatalf("unexpected call: %+v", calls[1])
+	}
+}
+
+func TestOnCommandOncePerCommand(t *testing.T) {
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/redirect":
+			http.Redirect(w, r, "/target", 307)
+		case failures > 0:
+			failures--
+			http.Error(w, "overloaded", 500)
+		default:
+			writeMockResponse(w, 200, 0, "done")
+		}
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.GetRetries = 1
+	d.GetRetryBackoff = time.Millisecond
+	var urls []string
+	var statuses []int
+	d.OnCommand = func(method, url string, status int, dur time.Duration, err error) {
+		urls = append(urls, url)
+		statuses = append(statuses, status)
+	}
+	var records recordLogger
+	d.SetCommandLogger(&records)
+	if _, _, err := d.do(nil, "GET", "/redirect"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(urls, []string{server.URL + "/redirect"}) || !reflect.DeepEqual(statuses, []int{200}) {
+		t.Fatalf("unexpected calls: %v %v", urls, statuses)
+	}
+	if len(records) != 1 || records[0].StatusCode != 200 || records[0].ResponseBody == "" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestNewSessionProtocol(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		w3c   bool
+	}{
+		{map[string]interface{}{"browserName": "chrome", "version": "80.0"}, false},
+		{map[string]interface{}{"sessionId": "mock", "capabilities": map[string]interface{}{"browserName": "chrome"}}, true},
+	}
+	for _, test := range tests {
+		s, _ := newMockSession(t, func(r mockRequest) interface{} { return test.value })
+		session, err := s.wd.(*ChromeDriver).newSession(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.W3C != test.w3c {
+			t.Fatalf("%v: W3C = %v, want %v", test.value, session.W3C, test.w3c)
+		}
+	}
+}
+
+//response of geckodriver to the new session command: no status and no top level session id.
+const geckodriverNewSession = `{"value":{"sessionId":"6f0d1f3e-9d5c-4d8e-a2a4-1b5f0f3c9e21","capabilities":{` +
+	`"acceptInsecureCerts":false,"browserName":"firefox","browserVersion":"115.0","moz:processID":4242,` +
+	`"pageLoadStrategy":"normal","platformName":"linux","setWindowRect":true,` +
+	`"timeouts":{"implicit":0,"pageLoad":300000,"script":30000}}}}`
+
+func TestNewSessionW3CResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, geckodriverNewSession)
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	for _, newSession := range []func(desired, required Capabilities) (*Session, error){d.newSession, d.newW3CSession} {
+		session, err := newSession(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Id != "6f0d1f3e-9d5c-4d8e-a2a4-1b5f0f3c9e21" || !session.W3C {
+			t.Fatalf("unexpected session: %+v", session)
+		}
+		if session.Capabilities["browserName"] != "firefox" || session.Capabilities["browserVersion"] != "115.0" {
+			t.Fatalf("unexpected capabilities: %v", session.Capabilities)
+		}
+		if _, found := session.Capabilities["sessionId"]; found {
+			t.Fatalf("capabilities not unwrapped: %v", session.Capabilities)
+		}
+	}
+}
+
+func TestRawCapabilities(t *testing.T) {
+	legacy := `{"version":"80.0","browserName":"chrome","chrome":{"chromedriverVersion":"80.0.3987.106"},"rotatable":false}`
+	tests := []struct {
+		response string
+		raw      string
+	}{
+		{geckodriverNewSession, geckodriverNewSession[strings.Index(geckodriverNewSession, `{"acceptInsecureCerts"`) : len(geckodriverNewSession)-2]},
+		{`{"sessionId":"legacy","status":0,"value":` + legacy + `}`, legacy},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			io.WriteString(w, test.response)
+		}))
+		d := NewChromeDriver("")
+		d.url = server.URL
+		session, err := d.newSession(nil, nil)
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw := string(session.RawCapabilities()); raw != test.raw {
+			t.Fatalf("raw capabilities not preserved:\n%s\nwant:\n%s", raw, test.raw)
+		}
+	}
+}
+
+func TestNewSessionLegacyResponse(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return map[string]interface{}{"browserName": "chrome", "version": "80.0"}
+	})
+	//a legacy driver may answer with the flat capabilities to a W3C request
+	session, err := s.wd.(*ChromeDriver).newW3CSession(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Id != "mock" || session.W3C || session.Capabilities["version"] != "80.0" {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+}
+
+func TestNewSessionRetry(t *testing.T) {
+	attempts := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		attempts++
+		if attempts < 3 {
+			return mockError{500, 0, "not ready"}
+		}
+		return map[string]interface{}{"browserName": "chrome"}
+	})
+	d := s.wd.(*ChromeDriver)
+	session, err := d.newSession(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Id != "mock" || attempts != 3 {
+		t.Fatalf("unexpected session %q after %d attempts", session.Id, attempts)
+	}
+	attempts = 0
+	d.SessionCreateRetries = -1
+	if _, err = d.newSession(nil, nil); err == nil || attempts != 1 {
+		t.Fatalf("retries disabled: %v after %d attempts", err, attempts)
+	}
+	//the waits between the attempts are bounded by CommandTimeout
+	attempts = -1000
+	d.SessionCreateRetries = 100
+	d.CommandTimeout = 300 * time.Millisecond
+	start := time.Now()
+	if _, err = d.newSession(nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("retries not aborted by CommandTimeout after %v", time.Since(start))
+	}
+}
+
+func TestNewSessionErrorNotRetried(t *testing.T) {
+	tests := []mockError{
+		{500, 0, map[string]string{"error": "unknown error", "message": "unknown error: Chrome failed to start: crashed", "stacktrace": ""}},
+		{500, UnknownError, map[string]string{"message": "chrome not reachable"}},
+		{500, 0, map[string]string{"error": "session not created", "message": "session not created: This version of ChromeDriver only supports Chrome version 114",
+			"stacktrace": "#0 0x55d4c3a1b6e3 <unknown>\n"}},
+		{500, SessionNotCreatedException, map[string]string{"message": "cannot find Chrome binary"}},
+	}
+	for _, test := range tests {
+		attempts := 0
+		s, _ := newMockSession(t, func(r mockRequest) interface{} {
+			attempts++
+			return test
+		})
+		_, err := s.wd.(*ChromeDriver).newSession(nil, nil)
+		if err == nil || attempts != 1 {
+			t.Fatalf("%v after %d attempts", err, attempts)
+		}
+	}
+}
+
+func TestNewSessionRetryConnectionRefused(t *testing.T) {
+	port := freePort(t)
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	server := &http.Server{Addr: address, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMockResponse(w, http.StatusOK, 0, map[string]interface{}{"browserName": "chrome"})
+	})}
+	defer server.Close()
+	//the server starts listening after the first attempt
+	time.AfterFunc(50*time.Millisecond, func() { server.ListenAndServe() })
+	d := NewChromeDriver("")
+	d.url = "http://" + address
+	session, err := d.newSession(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Capabilities["browserName"] != "chrome" {
+		t.Fatalf("unexpected capabilities: %v", session.Capabilities)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	failures := 0
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if failures > 0 {
+			failures--
+			return mockError{500, 0, map[string]string{"error": "unknown error", "message": "busy"}}
+		}
+		return "http://example.com/"
+	})
+	d := s.wd.(*ChromeDriver)
+	failures = 1
+	if _, err := s.GetUrl(); err == nil {
+		t.Fatal("GET retried by default")
+	}
+	d.GetRetries = 2
+	d.GetRetryBackoff = time.Millisecond
+	*requests = nil
+	failures = 1
+	url, err := s.GetUrl()
+	if err != nil || url != "http://example.com/" {
+		t.Fatalf("unexpected result: %q %v", url, err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("unexpected requests: %+v", *requests)
+	}
+	failures = 3
+	if _, err = s.GetUrl(); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	*requests = nil
+	failures = 1
+	if err = s.Url("http://example.com/"); err == nil {
+		t.Fatal("POST retried")
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("unexpected requests: %+v", *requests)
+	}
+}
+
+func TestGetRetriesSemanticError(t *testing.T) {
+	tests := []mockError{
+		{500, 0, map[string]string{"error": "unexpected alert open", "message": "unexpected alert open", "stacktrace": ""}},
+		{500, 0, map[string]string{"error": "javascript error", "message": "x is not defined", "stacktrace": ""}},
+		{500, StaleElementReference, map[string]string{"message": "stale"}},
+		{500, NoSuchWindow, map[string]string{"message": "no such window"}},
+	}
+	for _, e := range tests {
+		s, requests := newMockSession(t, func(r mockRequest) interface{} { return e })
+		s.wd.(*ChromeDriver).GetRetries = 3
+		if _, err := s.GetUrl(); err == nil {
+			t.Fatalf("%v: error not reported", e.Value)
+		}
+		if len(*requests) != 1 {
+			t.Fatalf("%v: retried %d times", e.Value, len(*requests)-1)
+		}
+	}
+	//a response that isn't a WebDriver error (e.g. from a proxy) is retried
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "upstream overloaded", 500)
+			return
+		}
+		writeMockResponse(w, 200, 0, "http://example.com/")
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.GetRetries = 1
+	d.GetRetryBackoff = time.Millisecond
+	s := &Session{Id: "mock", wd: d}
+	if url, err := s.GetUrl(); err != nil || url != "http://example.com/" || attempts != 2 {
+		t.Fatalf("non WebDriver error not retried: %q %v after %d attempts", url, err, attempts)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	var received []mockRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, mockRequest{r.Method, r.URL.Path, string(body)})
+		switch {
+		case r.URL.Path == "/loop":
+			http.Redirect(w, r, "/loop", 302)
+		case strings.HasPrefix(r.URL.Path, "/redirect/"):
+			code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+			http.Redirect(w, r, "/target", code)
+		default:
+			writeMockResponse(w, http.StatusOK, 0, "done")
+		}
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	tests := []struct {
+		method string
+		code   int
+		target mockRequest
+	}{
+		{"POST", 301, mockRequest{"GET", "/target", ""}},
+		{"POST", 302, mockRequest{"GET", "/target", ""}},
+		{"POST", 303, mockRequest{"GET", "/target", ""}},
+		{"POST", 307, mockRequest{"POST", "/target", `{"a":1}`}},
+		{"POST", 308, mockRequest{"POST", "/target", `{"a":1}`}},
+		{"GET", 301, mockRequest{"GET", "/target", ""}},
+		{"GET", 303, mockRequest{"GET", "/target", ""}},
+		{"DELETE", 302, mockRequest{"DELETE", "/target", ""}},
+		{"DELETE", 303, mockRequest{"GET", "/target", ""}},
+	}
+	for _, test := range tests {
+		received = nil
+		var p params
+		if test.method == "POST" {
+			p = params{"a": 1}
+		}
+		_, data, err := d.do(p, test.method, "/redirect/%d", test.code)
+		if err != nil {
+			t.Fatalf("%s %d: %v", test.method, test.code, err)
+		}
+		if string(data) != `"done"` || len(received) != 2 || received[1] != test.target {
+			t.Fatalf("%s %d: unexpected requests %v", test.method, test.code, received)
+		}
+	}
+	received = nil
+	if _, _, err := d.do(nil, "GET", "/loop"); err == nil || len(received) != 11 {
+		t.Fatalf("redirect loop: %v after %d requests", err, len(received))
+	}
+	received = nil
+	d.MaxRedirects = -1
+	if _, _, err := d.do(nil, "GET", "/redirect/307"); err == nil || len(received) != 1 {
+		t.Fatalf("redirects disabled: %v after %d requests", err, len(received))
+	}
+}
+
+type recordLogger []CommandRecord
+
+func (l *recordLogger) LogCommand(r CommandRecord) {
+	*l = append(*l, r)
+}
+
+func TestPrettyDebug(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return map[string]interface{}{"x": 1, "y": 2}
+	})
+	logger := &recordLogger{}
+	d := s.wd.(*ChromeDriver)
+	d.SetCommandLogger(logger)
+	if err := s.SetTimeouts("page load", 2000); err != nil {
+		t.Fatal(err)
+	}
+	r := (*logger)[0]
+	if strings.Contains(r.RequestBody, "\n") || strings.Contains(r.ResponseBody, "\n") {
+		t.Fatalf("bodies should be on a single line by default:\n%s\n%s", r.RequestBody, r.ResponseBody)
+	}
+	d.PrettyDebug = true
+	if err := s.SetTimeouts("page load", 2000); err != nil {
+		t.Fatal(err)
+	}
+	r = (*logger)[1]
+	if !strings.Contains(r.RequestBody, "\n  \"ms\": 2000") {
+		t.Fatalf("request body not indented:\n%s", r.RequestBody)
+	}
+	if !strings.Contains(r.ResponseBody, "\n    \"x\": 1") {
+		t.Fatalf("response body not indented:\n%s", r.ResponseBody)
+	}
+}
+
+func TestDebugBodyLimit(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return strings.Repeat("a", 2000)
+	})
+	logger := &recordLogger{}
+	d := s.wd.(*ChromeDriver)
+	d.SetCommandLogger(logger)
+	if _, err := s.GetUrl(); err != nil {
+		t.Fatal(err)
+	}
+	d.DebugBodyLimit = 10
+	if _, err := s.GetUrl(); err != nil {
+		t.Fatal(err)
+	}
+	if body := (*logger)[0].ResponseBody; len(body) < 1024 || !strings.HasSuffix(body, "more bytes") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if body := (*logger)[1].ResponseBody; !strings.HasPrefix(body, (*logger)[0].ResponseBody[:10]+" ...") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if (*logger)[0].RequestBody != "" {
+		t.Fatalf("GET requests have no body: %s", (*logger)[0].RequestBody)
+	}
+}
+
+func benchmarkTransport(b *testing.B, client *http.Client) {
+	debug = false
+	defer func() { debug = true }()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeMockResponse(w, 200, 0, "http://example.com/")
+	}))
+	defer server.Close()
+	d := NewChromeDriver("")
+	d.url = server.URL
+	d.HTTPClient = client
+	s := Session{Id: "mock", wd: d}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := s.GetUrl(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDefaultTransport(b *testing.B) {
+	benchmarkTransport(b, http.DefaultClient)
+}
+
+func BenchmarkTunedTransport(b *testing.B) {
+	benchmarkTransport(b, nil)
+}
+
+func xTestIME(t *testing.T) {
+	checkSession(t)
+	// TODO IMEAvailableEngines
+	// TODO IMEActiveEngine
+	// TODO IsIMEActivated
+	// TODO IMEDeactivate
+	// TODO IMEActivate
+}
+
+func TestFindElementsTextMock(t *testing.T) {
+	stale := 1
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if strings.HasSuffix(r.Path, "/elements") {
+			return []map[string]string{{"ELEMENT": "e1"}, {"ELEMENT": "e2"}}
+		}
+		if strings.HasSuffix(r.Path, "/e2/text") && stale > 0 {
+			stale--
+			return mockError{404, 0, map[string]string{"error": "stale element reference", "message": "stale"}}
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(r.Path, "/session/mock/element/"), "/text")
+	})
+	texts, err := s.FindElementsText(CSS_Selector, "li")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(texts, []string{"e1", "e2"}) {
+		t.Fatalf("unexpected texts: %v", texts)
+	}
+	if len(*requests) != 6 {
+		t.Fatalf("elements not found again: %+v", *requests)
+	}
+}
+
+func TestFindElementsText(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("list"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts, err := session.FindElementsText(CSS_Selector, "#rows li")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(texts, []string{"First", "Second", "Third"}) {
+		t.Fatalf("unexpected texts: %v", texts)
+	}
+	texts, err = session.FindElementsText(CSS_Selector, "#rows td")
+	if err != nil || len(texts) != 0 {
+		t.Fatalf("unexpected result: %v %v", texts, err)
+	}
+}
+
+func TestSendKeysSlowlyMock(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} { return nil })
+	e := s.WebElementFromId("e1")
+	if err := e.SendKeysSlowly("aè", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 || (*requests)[0].Body != `{"value":["a"]}` || (*requests)[1].Body != `{"value":["è"]}` {
+		t.Fatalf("unexpected requests: %+v", *requests)
+	}
+}
+
+func TestSendKeysSlowly(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("keyup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := session.FindElement(ID, "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "slow typing"
+	if err = input.SendKeysSlowly(text, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	value, err := input.GetAttribute("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != text {
+		t.Fatalf("unexpected value: %q", value)
+	}
+	count, err := session.FindElement(ID, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := count.Text(); err != nil || got != strconv.Itoa(len(text)) {
+		t.Fatalf("unexpected keyup count: %q %v", got, err)
+	}
+}
+
+func TestWithinFrame(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("nested"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	title := func() string {
+		data, err := session.ExecuteScript("return document.title;", []interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	failure := errors.New("failure")
+	err = session.WithinFrame("outer", func() error {
+		if got := title(); got != `"webdriver frames"` {
+			t.Fatalf("unexpected outer frame title: %s", got)
+		}
+		err := session.WithinFrame("second", func() error {
+			if got := title(); got != `"webdriver simple 2"` {
+				t.Fatalf("unexpected inner frame title: %s", got)
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := title(); got != `"webdriver frames"` {
+			t.Fatalf("outer frame not restored: %s", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := title(); got != `"webdriver nested"` {
+		t.Fatalf("top level document not restored: %s", got)
+	}
+	if err = session.WithinFrame("missing", func() error {
+		t.Fatal("f called for a missing frame")
+		return nil
+	}); err == nil {
+		t.Fatal("missing frame should fail")
+	}
+}
+
+func TestSwitchToFrameByNameMock(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if strings.HasSuffix(r.Path, "/execute") {
+			return []string{"first", "", "second"}
+		}
+		return nil
+	})
+	if err := s.SwitchToFrameByName("second"); err != nil {
+		t.Fatal(err)
+	}
+	r := (*requests)[1]
+	if r.Path != "/session/mock/frame" || r.Body != `{"id":2}` {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	err := s.SwitchToFrameByName("third")
+	if err == nil || !strings.Contains(err.Error(), "[first, , second]") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("unexpected requests: %v", *requests)
+	}
+}
+
+func TestFrameNames(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("frames"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := session.FrameNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"first", "second"}) {
+		t.Fatalf("unexpected frame names: %v", names)
+	}
+	if err = session.SwitchToFrameByName("second"); err != nil {
+		t.Fatal(err)
+	}
+	//Title returns the title of the top level document
+	data, err := session.ExecuteScript("return document.title;", []interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"webdriver simple 2"` {
+		t.Fatalf("unexpected frame title: %s", data)
+	}
+	if err = session.FocusOnFrame(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.SwitchToFrameByName("missing"); err == nil {
+		t.Fatal("missing frame should fail")
+	}
+}
+
+func xTestFocusOnFrame(t *testing.T) {
+	checkSession(t)
+	// TODO FocusOnFrame
+}
+
+func TestWindow(t *testing.T) {
+	checkSession(t)
+	// TODO session.FocusOnWindow
+	// TODO session.CloseCurrentWindow
+	// TODO wh.SetPosition
+	// TODO wh.GetPosition
+	// TODO wh.Maximize
+	wh := session.GetCurrentWindowHandle()
+	size, err := wh.GetSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//t.Logf("width: %d, height: %d", size.Width, size.Height)
+	err = wh.SetSize(Size{size.Width / 2, size.Height / 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1 * time.Second)
+	size2, err := wh.GetSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//t.Logf("width2: %d, height2: %d", size2.Width, size2.Height)
+	time.Sleep(3 * time.Second)
+	if size2.Width != size.Width/2 || size2.Height != size.Height/2 {
+		t.Log(size2.Width, size.Width/2, size2.Height, size.Height/2)
+		t.Fatal("size got with GetSize different from size set with SetSize")
+	}
+	err = wh.SetSize(Size{size.Width, size.Height})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWindowRectFallback(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Path == "/session/mock/window/rect" {
+			return map[string]int{"x": 10, "y": 20, "width": 800, "height": 600}
+		}
+		return mockError{404, 0, map[string]string{"error": "unknown command", "message": "unknown command: " + r.Path}}
+	})
+	wh := s.GetCurrentWindowHandle()
+	size, err := wh.GetSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != (Size{800, 600}) {
+		t.Fatalf("unexpected size: %+v", size)
+	}
+	position, err := wh.GetPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != (Position{10, 20}) {
+		t.Fatalf("unexpected position: %+v", position)
+	}
+	if err = wh.SetSize(Size{400, 300}); err != nil {
+		t.Fatal(err)
+	}
+	if err = wh.SetPosition(Position{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	for _, r := range *requests {
+		calls = append(calls, r.Method+" "+r.Path+" "+r.Body)
+	}
+	expected := []string{
+		"GET /session/mock/window/current/size ",
+		"GET /session/mock/window/rect ",
+		"GET /session/mock/window/current/position ",
+		"GET /session/mock/window/rect ",
+		`POST /session/mock/window/current/size {"height":300,"width":400}`,
+		`POST /session/mock/window/rect {"height":300,"width":400}`,
+		`POST /session/mock/window/current/position {"x":0,"y":0}`,
+		`POST /session/mock/window/rect {"x":0,"y":0}`,
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("unexpected requests:\n%s", strings.Join(calls, "\n"))
+	}
+}
+
+func xTestCookie(t *testing.T) {
+	checkSession(t)
+	// TODO GetCookies
+	// TODO SetCookie
 	// TODO DeleteCookies
 	// TODO DeleteCookieByName
 }
 
-func TestElements(t *testing.T) {
+func TestCookiesMap(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return []map[string]interface{}{
+			{"name": "session", "value": "abc", "path": "/"},
+			{"name": "theme", "value": "dark", "path": "/"},
+		}
+	})
+	cookies, err := s.GetCookiesMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 2 || cookies["session"].Value != "abc" || cookies["theme"].Value != "dark" {
+		t.Fatalf("unexpected cookies: %+v", cookies)
+	}
+	value, found, err := s.CookieValue("theme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || value != "dark" {
+		t.Fatalf("unexpected cookie value: %q, %v", value, found)
+	}
+	if _, found, _ = s.CookieValue("missing"); found {
+		t.Fatal("missing cookie found")
+	}
+}
+
+func TestDeleteCookieMatching(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Method == "GET" {
+			return []map[string]interface{}{
+				{"name": "session", "value": "abc", "path": "/", "domain": "example.com"},
+				{"name": "theme", "value": "dark", "path": "/a", "domain": "example.com"},
+				{"name": "theme", "value": "light", "path": "/b", "domain": "example.com"},
+				{"name": "tracker", "value": "1", "path": "/a", "domain": "example.com"},
+			}
+		}
+		return nil
+	})
+	deletes := func() []string {
+		var paths []string
+		for _, r := range *requests {
+			if r.Method == "DELETE" {
+				paths = append(paths, r.Path)
+			}
+		}
+		*requests = nil
+		return paths
+	}
+	err := s.DeleteCookieMatching(func(c Cookie) bool { return c.Path == "/a" })
+	cerr, ok := err.(*CookieDeleteError)
+	if !ok || len(cerr.Cookies) != 1 || cerr.Cookies[0].Value != "dark" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(err.Error(), "theme (domain example.com, path /a)") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+	if paths := deletes(); !reflect.DeepEqual(paths, []string{"/session/mock/cookie/tracker"}) {
+		t.Fatalf("unexpected deletes: %v", paths)
+	}
+	if err = s.DeleteCookieMatching(func(c Cookie) bool { return c.Name != "session" }); err != nil {
+		t.Fatal(err)
+	}
+	if paths := deletes(); !reflect.DeepEqual(paths, []string{"/session/mock/cookie/theme", "/session/mock/cookie/tracker"}) {
+		t.Fatalf("unexpected deletes: %v", paths)
+	}
+}
+
+func TestCookieValue(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.SetCookie(Cookie{Name: "flavor", Value: "chocolate", Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	defer session.DeleteCookieByName("flavor")
+	value, found, err := session.CookieValue("flavor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || value != "chocolate" {
+		t.Fatalf("unexpected cookie value: %q, %v", value, found)
+	}
+}
+
+func TestElements(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElement(ID, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wev, err := session.FindElements(ID, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if we.id != wev[0].id {
+		t.Fatal("ids of same element differ")
+	}
+	we2, err := we.FindElement(PartialLinkText, "linktogo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := we2.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "longwordlinktogolang" {
+		t.Fatal("got wrong text")
+	}
+	// TODO FindElement
+	// TODO FindElements
+	// TODO GetActiveElement
+	// TODO element.FindElement
+	// TODO element.FindElements
+	// TODO element.Click
+	// TODO element.Submit
+	// TODO element.Text
+	// TODO element.SendKeys
+	// TODO SendKeysOnActiveElement
+	// TODO element.Name
+	// TODO element.Clear
+	// TODO element.IsSelected
+	// TODO element.IsEnabled
+	// TODO element.GetAttribute
+	// TODO element.Equals
+	// TODO element.IsDisplayed
+	// TODO element.GetLocation
+	// TODO element.GetLocationInView
+	// TODO element.Size
+}
+
+func TestGetActiveElementMethod(t *testing.T) {
+	for _, w3c := range []bool{false, true} {
+		s, requests := newMockSession(t, func(r mockRequest) interface{} {
+			return map[string]string{webElementIdentifier: "active"}
+		})
+		s.W3C = w3c
+		we, err := s.GetActiveElement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if we.id != "active" {
+			t.Fatalf("unexpected element id: %q", we.id)
+		}
+		expected := "POST"
+		if w3c {
+			expected = "GET"
+		}
+		if method := (*requests)[0].Method; method != expected {
+			t.Fatalf("W3C=%v: expected %s, got %s", w3c, expected, method)
+		}
+	}
+}
+
+func TestGetActiveElement(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := session.FindElement(ID, "text1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = input.Click(); err != nil {
+		t.Fatal(err)
+	}
+	active, err := session.GetActiveElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.id != input.id {
+		t.Fatalf("active element %q differs from focused input %q", active.id, input.id)
+	}
+}
+
+func TestIsSelectedEndpoint(t *testing.T) {
+	for _, w3c := range []bool{false, true} {
+		s, requests := newMockSession(t, func(r mockRequest) interface{} { return true })
+		s.W3C = w3c
+		selected, err := s.WebElementFromId("0").IsSelected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !selected {
+			t.Fatal("element should be selected")
+		}
+		expected := "/session/mock/element/0/value"
+		if w3c {
+			expected = "/session/mock/element/0/selected"
+		}
+		if path := (*requests)[0].Path; path != expected {
+			t.Fatalf("W3C=%v: expected %s, got %s", w3c, expected, path)
+		}
+	}
+}
+
+func TestIsSelected(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check1, err := session.FindElement(Name, "check1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check2, err := session.FindElement(Name, "check2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = check1.Click(); err != nil {
+		t.Fatal(err)
+	}
+	selected, err := check1.IsSelected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !selected {
+		t.Fatal("check1 should be selected")
+	}
+	selected, err = check2.IsSelected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected {
+		t.Fatal("check2 should not be selected")
+	}
+}
+
+func TestValueProperty(t *testing.T) {
+	for _, w3c := range []bool{false, true} {
+		s, requests := newMockSession(t, func(r mockRequest) interface{} { return "typed" })
+		s.W3C = w3c
+		value, err := s.WebElementFromId("0").Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "typed" {
+			t.Fatalf("unexpected value: %q", value)
+		}
+		expected := "/session/mock/execute"
+		if w3c {
+			expected = "/session/mock/element/0/property/value"
+		}
+		if path := (*requests)[0].Path; path != expected {
+			t.Fatalf("W3C=%v: expected %s, got %s", w3c, expected, path)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := session.FindElement(ID, "text1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = input.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err = input.SendKeys("typed"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := input.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "typed" {
+		t.Fatalf("unexpected value: %q", value)
+	}
+	//depending on the driver the attribute is the default value or the live one
+	attribute, err := input.GetAttribute("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("value attribute: %q", attribute)
+}
+
+func TestFindElementWaitMock(t *testing.T) {
+	attempts := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		attempts++
+		if attempts < 3 {
+			return mockError{404, 0, map[string]string{"error": "no such element", "message": "not yet"}}
+		}
+		return map[string]string{webElementIdentifier: "late"}
+	})
+	we, err := s.FindElementWait(ID, "late", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if we.id != "late" || attempts != 3 {
+		t.Fatalf("unexpected element %q after %d attempts", we.id, attempts)
+	}
+}
+
+func TestDefaultFindTimeout(t *testing.T) {
+	attempts := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		attempts++
+		if attempts%3 != 0 {
+			return mockError{404, 0, map[string]string{"error": "no such element", "message": "not yet"}}
+		}
+		return map[string]string{webElementIdentifier: "late"}
+	})
+	if _, err := s.FindElement(ID, "late"); !isStatus(err, NoSuchElement) || attempts != 1 {
+		t.Fatalf("without DefaultFindTimeout: %v after %d attempts", err, attempts)
+	}
+	s.DefaultFindTimeout = 5 * time.Second
+	we, err := s.FindElement(ID, "late")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if we.id != "late" || attempts != 3 {
+		t.Fatalf("unexpected element %q after %d attempts", we.id, attempts)
+	}
+	if _, err = we.FindElement(ID, "child"); err != nil || attempts != 6 {
+		t.Fatalf("element search: %v after %d attempts", err, attempts)
+	}
+	//per call override
+	if _, err = s.FindElementWait(ID, "late", 0); !isStatus(err, NoSuchElement) || attempts != 7 {
+		t.Fatalf("override: %v after %d attempts", err, attempts)
+	}
+	s.DefaultFindTimeout = 300 * time.Millisecond
+	attempts = 1
+	start := time.Now()
+	_, err = s.FindElements(ID, "late")
+	if !isStatus(err, NoSuchElement) || time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("FindElements should not retry: %v", err)
+	}
+}
+
+func TestFindElementWaitTimeout(t *testing.T) {
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return mockError{404, 0, map[string]string{"error": "no such element", "message": "never"}}
+	})
+	_, err := s.FindElementWait(ID, "never", 300*time.Millisecond)
+	if !isStatus(err, NoSuchElement) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFindElementWait(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `window.setTimeout(function() {
+		var div = document.createElement("div");
+		div.id = "late";
+		div.style.display = "none";
+		document.body.appendChild(div);
+		window.setTimeout(function() { div.style.display = "block"; div.textContent = "late"; }, 500);
+	}, 500);`
+	if _, err = session.ExecuteScript(script, []interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = session.FindElementWait(ID, "late", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElementVisibleWait(ID, "late", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	displayed, err := we.IsDisplayed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !displayed {
+		t.Fatal("element should be displayed")
+	}
+}
+
+func TestFindElementStrategy(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		return map[string]string{webElementIdentifier: "0"}
+	})
+	_, err := s.FindElement("css", "#foo")
+	if err == nil || !strings.Contains(err.Error(), `unknown find element strategy: "css"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = s.WebElementFromId("0").FindElements("css", "#foo"); err == nil {
+		t.Fatal("FindElements should fail")
+	}
+	if len(*requests) != 0 {
+		t.Fatalf("expected no requests, got %d", len(*requests))
+	}
+	RegisterFindElementStrategy("-custom")
+	if _, err = s.FindElement("-custom", "foo"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetAttributeOK(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		result  string
+		present bool
+	}{
+		{nil, "", false},
+		{"", "", true},
+		{"foo", "foo", true},
+	}
+	for _, test := range tests {
+		s, _ := newMockSession(t, func(r mockRequest) interface{} { return test.value })
+		value, present, err := s.WebElementFromId("0").GetAttributeOK("disabled")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != test.result || present != test.present {
+			t.Fatalf("%v: got (%q, %v), expected (%q, %v)", test.value, value, present, test.result, test.present)
+		}
+	}
+}
+
+func TestSetText(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := session.FindElement(ID, "text1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = input.SetText("replaced"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := input.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "replaced" {
+		t.Fatalf("unexpected value: %q", value)
+	}
+}
+
+func TestSubmitAndWaitMock(t *testing.T) {
+	var names, states int
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		switch {
+		case strings.HasSuffix(r.Path, "/element"):
+			return map[string]string{"ELEMENT": "root"}
+		case strings.HasSuffix(r.Path, "/root/name"):
+			//the old page changes (e.g. a spinner) before it is unloaded
+			names++
+			if names <= 2 {
+				return "html"
+			}
+			return mockError{404, 0, map[string]string{"error": "stale element reference", "message": "stale"}}
+		case strings.HasSuffix(r.Path, "/execute"):
+			states++
+			if states == 1 {
+				return "loading"
+			}
+			return "complete"
+		}
+		return nil
+	})
+	if err := s.WebElementFromId("form").SubmitAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if names != 3 || states != 2 {
+		t.Fatalf("returned before the new document was loaded: %d name and %d readyState requests", names, states)
+	}
+	for _, r := range *requests {
+		if strings.HasSuffix(r.Path, "/source") {
+			t.Fatalf("unexpected request: %+v", r)
+		}
+	}
+}
+
+func TestSubmitAndWait(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := session.FindElement(Name, "check1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = check.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if err = check.SubmitAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	url, err := session.GetUrl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != getUrl("elements")+"?check1=Check1&text1=default" {
+		t.Fatalf("unexpected url after submit: %s", url)
+	}
+}
+
+func TestWaitForAttributeMock(t *testing.T) {
+	reads := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		reads++
+		switch reads {
+		case 1:
+			return "false"
+		case 2:
+			return mockError{404, StaleElementReference, map[string]string{"message": "stale"}}
+		}
+		return "true"
+	})
+	if err := s.WebElementFromId("0").WaitForAttribute("aria-expanded", "true", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 3 {
+		t.Fatalf("expected 3 reads, got %d", reads)
+	}
+	err := s.WebElementFromId("0").WaitForAttribute("aria-expanded", "false", 200*time.Millisecond)
+	if err == nil || err.Error() != `wait for attribute aria-expanded: got "true", expected "false"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitForAttribute(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("elements"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElement(ID, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `window.setTimeout(function() {
+		var div = document.getElementById("foo");
+		div.setAttribute("aria-expanded", "true");
+		div.style.visibility = "hidden";
+	}, 300);`
+	if _, err = session.ExecuteScript(script, []interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = we.WaitForAttribute("aria-expanded", "true", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = we.WaitForCSSProperty("visibility", "hidden", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollapseSpaces(t *testing.T) {
+	tests := [][]string{
+		{"", ""},
+		{"   ", ""},
+		{"foo", "foo"},
+		{"  foo  ", "foo"},
+		{"foo   bar", "foo bar"},
+		{"\tfoo\n\n bar \r\n baz\t", "foo bar baz"},
+	}
+	for _, test := range tests {
+		if s := collapseSpaces(test[0]); s != test[1] {
+			t.Errorf("collapseSpaces(%q) = %q, want %q", test[0], s, test[1])
+		}
+	}
+}
+
+func TestTextNormalized(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("multiline"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElement(ID, "poem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := we.TextTrimmed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "Roses") || !strings.HasSuffix(text, "blue.") {
+		t.Fatalf("text not trimmed: %q", text)
+	}
+	text, err = we.TextCollapsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Roses are red, violets are blue." {
+		t.Fatalf("text not collapsed: %q", text)
+	}
+}
+
+func TestWebElementMarshalJSON(t *testing.T) {
+	buf, err := json.Marshal(WebElement{id: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"ELEMENT":"0","element-6066-11e4-a52e-4f735466cecf":"0"}`
+	if string(buf) != expected {
+		t.Fatalf("unexpected encoding: %s", buf)
+	}
+}
+
+func TestScrollIntoView(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	we, err := session.FindElement(ID, "bottom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = we.ScrollIntoView(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect, err := we.GetRect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := session.ExecuteScript("return [window.pageYOffset, window.innerHeight]", []interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var viewport []float64
+	if err = json.Unmarshal(res, &viewport); err != nil {
+		t.Fatal(err)
+	}
+	top, bottom := int(viewport[0]), int(viewport[0]+viewport[1])
+	if rect.Y < top || rect.Y+rect.Height > bottom {
+		t.Fatalf("element %+v not in viewport [%d, %d]", rect, top, bottom)
+	}
+}
+
+func TestElementCoordinates(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bottom, err := session.FindElement(ID, "bottom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bottom.ScrollIntoView(true); err != nil {
+		t.Fatal(err)
+	}
+	rect, err := bottom.GetRect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	center, err := bottom.Center()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if center.X != rect.X+rect.Width/2 || center.Y != rect.Y+rect.Height/2 {
+		t.Fatalf("center %+v doesn't match rect %+v", center, rect)
+	}
+	location, err := bottom.ViewportLocation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := session.ExecuteScript("return Math.round(window.pageYOffset);", []interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offset int
+	if err = json.Unmarshal(data, &offset); err != nil {
+		t.Fatal(err)
+	}
+	if location.X != rect.X || location.Y != rect.Y-offset {
+		t.Fatalf("viewport location %+v doesn't match rect %+v scrolled by %d", location, rect, offset)
+	}
+}
+
+func TestDecodeNumericStrings(t *testing.T) {
+	for _, data := range []string{`{"width":100,"height":50}`, `{"width":"100","height":"50"}`, `{"width":100.5,"height":"50.0"}`} {
+		var size Size
+		if err := json.Unmarshal([]byte(data), &size); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if size != (Size{100, 50}) {
+			t.Fatalf("%s: unexpected size %+v", data, size)
+		}
+	}
+	for _, data := range []string{`{"x":10,"y":-20}`, `{"x":"10","y":"-20"}`, `{"X":10,"Y":-20}`} {
+		var position Position
+		if err := json.Unmarshal([]byte(data), &position); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if position != (Position{10, -20}) {
+			t.Fatalf("%s: unexpected position %+v", data, position)
+		}
+	}
+	var size Size
+	if err := json.Unmarshal([]byte(`{"width":"wide","height":50}`), &size); err == nil {
+		t.Fatal("a non numeric string should fail")
+	}
+	var jr jsonResponse
+	if err := json.Unmarshal([]byte(`{"status":"7","value":{"message":"not found"}}`), &jr); err != nil {
+		t.Fatal(err)
+	}
+	if jr.Status != NoSuchElement {
+		t.Fatalf("unexpected status: %d", jr.Status)
+	}
+}
+
+func TestParseErrorW3C(t *testing.T) {
+	jr := jsonResponse{RawValue: []byte(`{"error":"no such element","message":"Unable to locate element"}`)}
+	err := parseError(404, jr)
+	cerr, ok := err.(*CommandError)
+	if !ok {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+	if cerr.StatusCode != NoSuchElement || cerr.Code != "no such element" || cerr.Message != "Unable to locate element" {
+		t.Fatalf("unexpected error: %+v", cerr)
+	}
+}
+
+func TestParseErrorW3CStacktrace(t *testing.T) {
+	//chromedriver sends the stack trace as a string
+	value := `{"error":"no such element","message":"no such element: Unable to locate element: {\"method\":\"css selector\",\"selector\":\"#missing\"}\n  (Session info: chrome=120.0.6099.109)",` +
+		`"stacktrace":"#0 0x55d4c3a1b6e3 <unknown>\n#1 0x55d4c3706c07 <unknown>\n"}`
+	err := parseError(404, jsonResponse{RawValue: []byte(value)})
+	if !isStatus(err, NoSuchElement) {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if cerr := err.(*CommandError); !strings.HasPrefix(cerr.Message, "no such element: Unable to locate element") {
+		t.Fatalf("unexpected message: %q", cerr.Message)
+	}
+	value = `{"error":"unexpected alert open","message":"unexpected alert open: {Alert text : hello}","stacktrace":"#0 0x0","data":{"text":"hello"}}`
+	text, ok := parseError(500, jsonResponse{RawValue: []byte(value)}).(*CommandError).AlertText()
+	if !ok || text != "hello" {
+		t.Fatalf("unexpected alert text: %q, %v", text, ok)
+	}
+}
+
+func TestCommandErrorAlertText(t *testing.T) {
+	tests := []struct {
+		status int
+		value  string
+		text   string
+		ok     bool
+	}{
+		{0, `{"error":"unexpected alert open","message":"unexpected alert open","data":{"text":"w3c"}}`, "w3c", true},
+		{26, `{"message":"Modal dialog present","alert":{"text":"legacy"}}`, "legacy", true},
+		{26, `{"message":"unexpected alert open: {Alert text : chrome}\n  (Session info: chrome=120.0)"}`, "chrome", true},
+		{26, `{"message":"Modal dialog present","alert":{"text":""}}`, "", true},
+		{26, `{"message":"Modal dialog present"}`, "", false},
+		{0, `{"error":"no such element","message":"{Alert text : other}","data":{"text":"other"}}`, "", false},
+	}
+	for _, test := range tests {
+		err := parseError(500, jsonResponse{Status: jsonInt(test.status), RawValue: []byte(test.value)})
+		text, ok := err.(*CommandError).AlertText()
+		if text != test.text || ok != test.ok {
+			t.Fatalf("%s: unexpected alert text %q, %v", test.value, text, ok)
+		}
+	}
+}
+
+func TestClickWhenClickableMock(t *testing.T) {
+	checks, clicks := 0, 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		switch {
+		case strings.HasSuffix(r.Path, "/displayed"):
+			return true
+		case strings.HasSuffix(r.Path, "/enabled"):
+			checks++
+			return checks >= 3
+		case strings.HasSuffix(r.Path, "/click"):
+			clicks++
+			if clicks == 1 {
+				return mockError{404, 0, map[string]string{"error": "stale element reference", "message": "re-rendered"}}
+			}
+		}
+		return nil
+	})
+	if err := s.WebElementFromId("0").ClickWhenClickable(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if checks != 3 || clicks != 2 {
+		t.Fatalf("unexpected %d checks and %d clicks", checks, clicks)
+	}
+	checks, clicks = -100, 0
+	if err := s.WebElementFromId("0").ClickWhenClickable(200 * time.Millisecond); err == nil || clicks != 0 {
+		t.Fatalf("a disabled element should not be clicked: %v, %d clicks", err, clicks)
+	}
+}
+
+func TestClickWhenClickable(t *testing.T) {
 	checkSession(t)
-	err := session.Url(getUrl("elements"))
+	err := session.Url(getUrl("delayed"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	we, err := session.FindElement(ID, "foo")
+	button, err := session.FindElement(ID, "late")
 	if err != nil {
 		t.Fatal(err)
 	}
-	wev, err := session.FindElements(ID, "foo")
+	if err = button.ClickWhenClickable(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := button.Text(); err != nil || text != "clicked" {
+		t.Fatalf("button not clicked: %q (%v)", text, err)
+	}
+}
+
+func TestClickSafely(t *testing.T) {
+	clicks := 0
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Path == "/session/mock/element/0/click" {
+			clicks++
+			if clicks == 1 {
+				return mockError{400, 0, map[string]string{
+					"error":   "element click intercepted",
+					"message": "Other element would receive the click",
+				}}
+			}
+		}
+		return nil
+	})
+	err := s.WebElementFromId("0").ClickSafely()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if we.id != wev[0].id {
-		t.Fatal("ids of same element differ")
+	var paths []string
+	for _, r := range *requests {
+		paths = append(paths, r.Path)
 	}
-	we2, err := we.FindElement(PartialLinkText, "linktogo")
+	expected := []string{"/session/mock/element/0/click", "/session/mock/execute", "/session/mock/element/0/click"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("unexpected requests: %v", paths)
+	}
+}
+
+func TestClickSafelyFails(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Path == "/session/mock/element/0/click" {
+			return mockError{500, UnknownError, map[string]string{
+				"message": "Element is not clickable at point (10, 10)",
+			}}
+		}
+		return nil
+	})
+	err := s.WebElementFromId("0").ClickSafely()
+	if !isClickIntercepted(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(*requests))
+	}
+}
+
+//a driver that doesn't spawn any process.
+type stubDriver struct {
+	WebDriverCore
+	started, stopped int
+}
+
+func (d *stubDriver) Start() error { d.started++; return nil }
+func (d *stubDriver) Stop() error  { d.stopped++; return nil }
+
+func (d *stubDriver) NewSession(desired, required Capabilities) (*Session, error) {
+	session, err := d.newSession(desired, required)
 	if err != nil {
+		return nil, err
+	}
+	session.wd = d
+	return session, nil
+}
+
+func (d *stubDriver) Sessions() ([]Session, error) { return d.sessions() }
+
+func TestQuit(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	if err := s.Quit(); err != nil {
 		t.Fatal(err)
 	}
-	text, err := we2.Text()
+	if r := (*requests)[0]; r.Method != "DELETE" || r.Path != "/session/mock" {
+		t.Fatalf("unexpected request: %s %s", r.Method, r.Path)
+	}
+}
+
+func TestStartSessionClose(t *testing.T) {
+	mock, requests := newMockSession(t, nil)
+	d := &stubDriver{WebDriverCore: mock.wd.(*ChromeDriver).WebDriverCore}
+	s, err := StartSession(d, Capabilities{}, Capabilities{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if text != "longwordlinktogolang" {
-		t.Fatal("got wrong text")
+	if d.started != 1 || s.Id != "mock" {
+		t.Fatalf("driver not started (%d) or wrong session id %q", d.started, s.Id)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[1]; r.Method != "DELETE" || r.Path != "/session/mock" {
+		t.Fatalf("unexpected request: %s %s", r.Method, r.Path)
+	}
+	if d.stopped != 1 {
+		t.Fatal("driver not stopped by Close")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	beats, inFlight, overlaps := 0, 0, 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		mu.Lock()
+		if r.Path == "/session/mock/url" {
+			beats++
+		}
+		inFlight++
+		if inFlight > 1 {
+			overlaps++
+		}
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return "http://example.com"
+	})
+	stop := s.StartHeartbeat(5 * time.Millisecond)
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if _, err := s.Title(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop()
+	stop()
+	mu.Lock()
+	n := beats
+	mu.Unlock()
+	if n < 3 {
+		t.Fatalf("expected at least 3 heartbeats, got %d", n)
+	}
+	if overlaps > 0 {
+		t.Fatalf("%d commands overlapped with the heartbeat", overlaps)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if beats != n {
+		t.Fatalf("heartbeat not stopped: %d requests after stop", beats-n)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		return map[string]int{"answer": 42}
+	})
+	data, err := s.Raw("POST", "/goog/cdp/execute", params{"cmd": "Browser.getVersion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"answer":42}` {
+		t.Fatalf("unexpected value: %s", data)
+	}
+	r := (*requests)[0]
+	if r.Method != "POST" || r.Path != "/session/mock/goog/cdp/execute" || r.Body != `{"cmd":"Browser.getVersion"}` {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	if _, err = s.Raw("GET", "/x?y=%z", nil); err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[1]; r.Path != "/session/mock/x?y=%z" {
+		t.Fatalf("path not escaped: %q", r.Path)
+	}
+	if _, err = s.Raw("GET", "/../other/url", nil); err == nil {
+		t.Fatal("Raw should reject paths leaving the session")
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(*requests))
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	var mu sync.Mutex
+	inflight, overlaps := 0, 0
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		mu.Lock()
+		inflight++
+		if inflight > 1 {
+			overlaps++
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		return "http://example.com"
+	})
+	s.Serialize()
+	s.Serialize()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetUrl(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if overlaps != 0 {
+		t.Fatalf("%d commands overlapped", overlaps)
+	}
+	if len(*requests) != 8 {
+		t.Fatalf("expected 8 requests, got %d", len(*requests))
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			writeMockResponse(w, 500, UnknownError, map[string]string{"message": "not ready"})
+			return
+		}
+		writeMockResponse(w, 200, 0, map[string]interface{}{"build": map[string]string{"version": "1.0"}})
+	}))
+	defer server.Close()
+	w := WebDriverCore{url: server.URL}
+	if err := w.WaitForReady(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 status requests, got %d", calls)
+	}
+	calls = -100
+	if err := w.WaitForReady(200 * time.Millisecond); err == nil {
+		t.Fatal("WaitForReady must fail after timeout")
+	}
+}
+
+func TestStatusDecoding(t *testing.T) {
+	bodies := []string{
+		`{"sessionId":"","status":0,"value":{"build":{"version":"2.1"},"os":{"arch":"x86_64","name":"Linux","version":"3.9"}}}`,
+		`{"value":{"build":{"version":"2.1"},"os":{"arch":"x86_64","name":"Linux","version":"3.9"},"message":"ChromeDriver ready for new sessions.","ready":true}}`,
+		`{"value":{"message":"Session already started","ready":false}}`,
+	}
+	expected := []Status{
+		{Build{Version: "2.1"}, OS{"x86_64", "Linux", "3.9"}, true, ""},
+		{Build{Version: "2.1"}, OS{"x86_64", "Linux", "3.9"}, true, "ChromeDriver ready for new sessions."},
+		{Build{}, OS{}, false, "Session already started"},
+	}
+	for i, body := range bodies {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		status, err := WebDriverCore{url: server.URL}.Status()
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *status != expected[i] {
+			t.Errorf("unexpected status %+v, expected %+v", *status, expected[i])
+		}
 	}
-	// TODO FindElement
-	// TODO FindElements
-	// TODO GetActiveElement
-	// TODO element.FindElement
-	// TODO element.FindElements
-	// TODO element.Click
-	// TODO element.Submit
-	// TODO element.Text
-	// TODO element.SendKeys
-	// TODO SendKeysOnActiveElement
-	// TODO element.Name
-	// TODO element.Clear
-	// TODO element.IsSelected
-	// TODO element.IsEnabled
-	// TODO element.GetAttribute
-	// TODO element.Equals
-	// TODO element.IsDisplayed
-	// TODO element.GetLocation
-	// TODO element.GetLocationInView
-	// TODO element.Size
 }
 
 func xTestCssProperty(t *testing.T) {
@@ -437,6 +2909,100 @@ func xTestOrientation(t *testing.T) {
 	// TODO SetOrientation
 }
 
+func TestWithImplicitWait(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if r.Method == "GET" {
+			return map[string]interface{}{"implicit": 250, "pageLoad": 300000, "script": nil}
+		}
+		return nil
+	})
+	s.W3C = true
+	bodies := func() []string {
+		var bodies []string
+		for _, r := range *requests {
+			if r.Path != "/session/mock/timeouts" {
+				t.Fatalf("unexpected request: %+v", r)
+			}
+			bodies = append(bodies, r.Method+" "+r.Body)
+		}
+		*requests = nil
+		return bodies
+	}
+	expected := []string{"GET ", `POST {"implicit":5000}`, `POST {"implicit":250}`}
+	ran := false
+	err := s.WithImplicitWait(5*time.Second, func() error {
+		ran = true
+		if b := bodies(); !reflect.DeepEqual(b, expected[:2]) {
+			t.Fatalf("unexpected requests before f: %v", b)
+		}
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("f not run: %v", err)
+	}
+	if b := bodies(); !reflect.DeepEqual(b, expected[2:]) {
+		t.Fatalf("timeout not restored: %v", b)
+	}
+	failure := errors.New("failure")
+	if err = s.WithImplicitWait(5*time.Second, func() error { return failure }); err != failure {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := bodies(); !reflect.DeepEqual(b, expected) {
+		t.Fatalf("timeout not restored after an error: %v", b)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic not propagated")
+			}
+		}()
+		s.WithImplicitWait(5*time.Second, func() error { panic("boom") })
+	}()
+	if b := bodies(); !reflect.DeepEqual(b, expected) {
+		t.Fatalf("timeout not restored after a panic: %v", b)
+	}
+}
+
+func TestWaitForAlertMock(t *testing.T) {
+	attempts := 0
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		attempts++
+		if attempts < 3 {
+			return mockError{404, 0, map[string]string{"error": "no such alert", "message": "not yet"}}
+		}
+		return "hello"
+	})
+	text, err := s.WaitForAlert(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "hello" || attempts != 3 {
+		t.Fatalf("unexpected text %q after %d attempts", text, attempts)
+	}
+	attempts = 0
+	if _, err = s.WaitForAlert(0); !isStatus(err, NoAlertOpenError) || attempts != 1 {
+		t.Fatalf("unexpected error: %v after %d attempts", err, attempts)
+	}
+}
+
+func TestWaitForAlert(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("alert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := session.WaitForAlert(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "delayed" {
+		t.Fatalf("unexpected alert text: %q", text)
+	}
+	if err = session.AcceptAlert(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func xTestAlert(t *testing.T) {
 	checkSession(t)
 	// TODO GetAlertText
@@ -473,6 +3039,259 @@ func xTestGeoLocation(t *testing.T) {
 	// TODO SetGeoLocation
 }
 
+func TestGeoLocationValidation(t *testing.T) {
+	s, requests := newMockSession(t, nil)
+	valid := []GeoLocation{{90, 180, 0}, {-90, -180, -10}, {45.5, 9.2, 120}}
+	for _, l := range valid {
+		if err := s.SetGeoLocation(l); err != nil {
+			t.Fatalf("%+v: %v", l, err)
+		}
+	}
+	invalid := []GeoLocation{
+		{90.001, 0, 0}, {-90.001, 0, 0}, {0, 180.001, 0}, {0, -180.001, 0},
+		{math.NaN(), 0, 0}, {0, math.NaN(), 0}, {math.Inf(1), 0, 0}, {0, 0, math.Inf(-1)},
+	}
+	for _, l := range invalid {
+		err := s.SetGeoLocation(l)
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid geo location") {
+			t.Fatalf("%+v: unexpected error: %v", l, err)
+		}
+	}
+	if len(*requests) != len(valid) {
+		t.Fatalf("expected %d requests, got %d", len(valid), len(*requests))
+	}
+}
+
+//start a mock session that implements the local and session storage commands.
+func newMockStorageSession(t *testing.T) *Session {
+	storage := map[string]map[string]string{"local_storage": {}, "session_storage": {}}
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		parts := strings.Split(r.Path, "/")
+		store := storage[parts[3]]
+		switch {
+		case r.Method == "POST":
+			var item struct{ Key, Value string }
+			json.Unmarshal([]byte(r.Body), &item)
+			store[item.Key] = item.Value
+		case r.Method == "DELETE" && len(parts) == 4:
+			for k := range store {
+				delete(store, k)
+			}
+		case r.Method == "DELETE":
+			delete(store, parts[5])
+		case len(parts) == 4:
+			var keys []string
+			for k := range store {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		case parts[4] == "key":
+			return store[parts[5]]
+		case parts[4] == "size":
+			return len(store)
+		}
+		return nil
+	})
+	return s
+}
+
+func TestStorageJSON(t *testing.T) {
+	type settings struct {
+		Theme string
+		Zoom  float64
+		Tabs  []string
+	}
+	s := newMockStorageSession(t)
+	in := settings{"dark", 1.5, []string{"inbox", "drafts"}}
+	if err := s.LocalStorageSetJSON("settings", in); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.LocalStorageGetKey("settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != `{"Theme":"dark","Zoom":1.5,"Tabs":["inbox","drafts"]}` {
+		t.Fatalf("unexpected stored value: %s", raw)
+	}
+	var out settings
+	if err = s.LocalStorageGetJSON("settings", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("unexpected value: %+v", out)
+	}
+	if err = s.SessionStorageSetJSON("count", 42); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err = s.SessionStorageGetJSON("count", &count); err != nil || count != 42 {
+		t.Fatalf("unexpected session storage value: %d (%v)", count, err)
+	}
+}
+
+func TestStorageSnapshotMock(t *testing.T) {
+	s := newMockStorageSession(t)
+	s.SessionStorageSetKey("a", "1")
+	s.SessionStorageSetKey("b", "2")
+	snapshot, err := s.SessionStorageSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot, map[string]string{"a": "1", "b": "2"}) {
+		t.Fatalf("unexpected snapshot: %v", snapshot)
+	}
+	s.SessionStorageSetKey("a", "changed")
+	s.SessionStorageSetKey("c", "3")
+	if err = s.SessionStorageRestore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := s.SessionStorageSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, snapshot) {
+		t.Fatalf("unexpected restored storage: %v", restored)
+	}
+}
+
+func TestExecuteScriptCheckedMock(t *testing.T) {
+	var result interface{}
+	s, _ := newMockSession(t, func(r mockRequest) interface{} {
+		return result
+	})
+	result = map[string]interface{}{"ok": true, "value": []int{1, 2}}
+	data, err := s.ExecuteScriptChecked("return [1, 2];", nil)
+	if err != nil || string(data) != "[1,2]" {
+		t.Fatalf("unexpected result: %s (%v)", data, err)
+	}
+	result = map[string]interface{}{"ok": true}
+	if data, err = s.ExecuteScriptChecked("return;", nil); err != nil || string(data) != "null" {
+		t.Fatalf("unexpected result: %s (%v)", data, err)
+	}
+	result = map[string]interface{}{"ok": false, "error": "Error: boom", "stack": "Error: boom\n    at fail"}
+	_, err = s.ExecuteScriptChecked("throw new Error('boom');", nil)
+	serr, ok := err.(*ScriptError)
+	if !ok || serr.Message != "Error: boom" || serr.Stack != "Error: boom\n    at fail" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
+
+func TestExecuteScriptChecked(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := session.ExecuteScriptChecked("return arguments[0] + arguments[1];", []interface{}{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "3" {
+		t.Fatalf("unexpected result: %s", data)
+	}
+	_, err = session.ExecuteScriptChecked("function fail() { throw new Error('boom'); }\nfail();", []interface{}{})
+	serr, ok := err.(*ScriptError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(serr.Message, "boom") || !strings.Contains(serr.Stack, "fail") {
+		t.Fatalf("unexpected script error: %+v", serr)
+	}
+}
+
+func TestResetStateMock(t *testing.T) {
+	s, requests := newMockSession(t, func(r mockRequest) interface{} {
+		if strings.HasSuffix(r.Path, "/local_storage") {
+			return mockError{404, 0, map[string]string{"error": "unknown command", "message": "no storage"}}
+		}
+		return nil
+	})
+	s.Capabilities = Capabilities{"browserName": "chrome"}
+	err := s.ResetState()
+	if err == nil || !strings.Contains(err.Error(), "clear local storage") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, r := range *requests {
+		paths = append(paths, r.Method+" "+r.Path)
+	}
+	expected := []string{
+		"DELETE /session/mock/cookie",
+		"DELETE /session/mock/local_storage",
+		"DELETE /session/mock/session_storage",
+		"POST /session/mock/goog/cdp/execute",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("unexpected requests: %v", paths)
+	}
+}
+
+func TestResetState(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.SetCookie(Cookie{Name: "reset", Value: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.LocalStorageSetKey("reset", "me"); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.SessionStorageSetKey("reset", "me"); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.ResetState(); err != nil {
+		t.Fatal(err)
+	}
+	cookies, err := session.GetCookies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 0 {
+		t.Fatalf("cookies not deleted: %v", cookies)
+	}
+	if local, err := session.LocalStorageSnapshot(); err != nil || len(local) != 0 {
+		t.Fatalf("local storage not cleared: %v (%v)", local, err)
+	}
+	if items, err := session.SessionStorageSnapshot(); err != nil || len(items) != 0 {
+		t.Fatalf("session storage not cleared: %v (%v)", items, err)
+	}
+}
+
+func TestStorageSnapshot(t *testing.T) {
+	checkSession(t)
+	err := session.Url(getUrl("simple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.LocalStorageRestore(map[string]string{"user": "gopher", "theme": "dark"}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := session.LocalStorageSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.LocalStorageSetKey("theme", "light"); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.LocalStorageSetKey("extra", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.LocalStorageRestore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := session.LocalStorageSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, map[string]string{"user": "gopher", "theme": "dark"}) {
+		t.Fatalf("unexpected restored storage: %v", restored)
+	}
+	session.LocalStorageClear()
+}
+
 func xTestStorage(t *testing.T) {
 	checkSession(t)
 	// TODO LocalStorageGetKeys